@@ -0,0 +1,399 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v2 "edgeworks.no/networktester/api/v2"
+)
+
+const (
+	// TimeoutAnnotation keeps a v2 timeout that is not a whole number of seconds, so it survives a round trip
+	// through v1
+	TimeoutAnnotation = "edgeworks.no/timeout"
+
+	// IntervalAnnotation and RetryDelayAnnotation keep v1 durations as written, when they are not written the way v2
+	// formats them, e.g. "1m" instead of "1m0s"
+	IntervalAnnotation   = "edgeworks.no/v1-interval"
+	RetryDelayAnnotation = "edgeworks.no/v1-retry-delay"
+
+	// ConversionDataAnnotation keeps the fields of a v2 test that cannot be represented in v1, like probe types only
+	// available in v2, so they survive a round trip through v1
+	ConversionDataAnnotation = "edgeworks.no/conversion-data"
+)
+
+// conversionData holds the fields of v2 not in v1, kept in the conversion data annotation
+type conversionData struct {
+	UDP      *v2.UDPProbe       `json:"udp,omitempty"`
+	ICMP     *v2.ICMPProbe      `json:"icmp,omitempty"`
+	GRPC     *v2.GRPCProbe      `json:"grpc,omitempty"`
+	TCPSteps []v2.TCPStep       `json:"tcpSteps,omitempty"`
+	Ping     *v2.PingStatistics `json:"ping,omitempty"`
+
+	// ExpectedOutcome is a particular blocked outcome, read as Blocked in v1
+	ExpectedOutcome   string `json:"expectedOutcome,omitempty"`
+	ConnectionOutcome string `json:"connectionOutcome,omitempty"`
+}
+
+var _ conversion.Convertible = &Networktest{}
+
+// ConvertTo converts this Networktest to the hub version (v2)
+func (src *Networktest) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v2.Networktest)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v2.NetworktestSpec{
+		Enabled:          copyBool(src.Spec.Enabled),
+		ExpectedOutcome:  src.Spec.ExpectedOutcome,
+		HTTP:             convertHttpProbeTo(src.Spec.Http),
+		TCP:              convertTCPProbeTo(src.Spec.TCP),
+		DNS:              (*v2.DNSProbe)(src.Spec.DNS.DeepCopy()),
+		TLS:              convertTLSProbeTo(src.Spec.TLS),
+		HistoryLimit:     src.Spec.HistoryLimit,
+		FailureThreshold: src.Spec.FailureThreshold,
+		SuccessThreshold: src.Spec.SuccessThreshold,
+		Retries:          src.Spec.Retries,
+	}
+
+	var interval, retryDelay string
+	dst.Spec.Interval, interval = durationTo(src.Spec.Interval)
+	dst.Spec.RetryDelay, retryDelay = durationTo(src.Spec.RetryDelay)
+	setAnnotation(&dst.ObjectMeta, IntervalAnnotation, interval)
+	setAnnotation(&dst.ObjectMeta, RetryDelayAnnotation, retryDelay)
+
+	if src.Spec.Timeout != 0 {
+		dst.Spec.Timeout = &metav1.Duration{Duration: time.Duration(src.Spec.Timeout) * time.Second}
+	}
+	// Use the exact timeout kept by ConvertFrom, unless the timeout has been changed through v1 since
+	if exact, ok := dst.Annotations[TimeoutAnnotation]; ok {
+		if d, err := time.ParseDuration(exact); err == nil && wholeSeconds(d) == src.Spec.Timeout {
+			dst.Spec.Timeout = &metav1.Duration{Duration: d}
+		}
+		setAnnotation(&dst.ObjectMeta, TimeoutAnnotation, "")
+	}
+
+	// An annotation that cannot be read is dropped, rather than making the test unreadable
+	var kept conversionData
+	if data, ok := dst.Annotations[ConversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &kept); err != nil {
+			kept = conversionData{}
+		}
+		setAnnotation(&dst.ObjectMeta, ConversionDataAnnotation, "")
+	}
+	dst.Spec.UDP = kept.UDP
+	dst.Spec.ICMP = kept.ICMP
+	dst.Spec.GRPC = kept.GRPC
+	if dst.Spec.TCP != nil {
+		dst.Spec.TCP.Steps = kept.TCPSteps
+	}
+	if kept.ExpectedOutcome != "" && src.Spec.ExpectedOutcome == OutcomeBlocked {
+		dst.Spec.ExpectedOutcome = kept.ExpectedOutcome
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = v2.NetworktestStatus{
+		Active:               status.Active,
+		Conditions:           status.Conditions,
+		LastRun:              status.LastRun,
+		NextRun:              status.NextRun,
+		ConsecutiveSuccesses: status.ConsecutiveSuccesses,
+		ConsecutiveFailures:  status.ConsecutiveFailures,
+		FailureReason:        status.FailureReason,
+		LastTimings:          (*v2.ProbeTimings)(status.LastTimings),
+		Ping:                 kept.Ping,
+		ConnectionOutcome:    kept.ConnectionOutcome,
+	}
+	if status.LastResult != nil {
+		dst.Status.LastResult = *status.LastResult
+	}
+	if status.Message != nil {
+		dst.Status.Message = *status.Message
+	}
+	for _, h := range status.History {
+		dst.Status.History = append(dst.Status.History, v2.ResultHistoryEntry(h))
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v2) to this version. Timeouts are rounded up to whole seconds, and the
+// exact timeout is kept in an annotation, as are fields only available in v2.
+func (dst *Networktest) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v2.Networktest)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = NetworktestSpec{
+		Interval:         durationFrom(src.Spec.Interval, dst.Annotations[IntervalAnnotation]),
+		Enabled:          copyBool(src.Spec.Enabled),
+		ExpectedOutcome:  src.Spec.ExpectedOutcome,
+		Http:             convertHttpProbeFrom(src.Spec.HTTP),
+		TCP:              convertTCPProbeFrom(src.Spec.TCP),
+		DNS:              (*DNSProbe)(src.Spec.DNS.DeepCopy()),
+		TLS:              convertTLSProbeFrom(src.Spec.TLS),
+		HistoryLimit:     src.Spec.HistoryLimit,
+		FailureThreshold: src.Spec.FailureThreshold,
+		SuccessThreshold: src.Spec.SuccessThreshold,
+		Retries:          src.Spec.Retries,
+		RetryDelay:       durationFrom(src.Spec.RetryDelay, dst.Annotations[RetryDelayAnnotation]),
+	}
+	setAnnotation(&dst.ObjectMeta, IntervalAnnotation, "")
+	setAnnotation(&dst.ObjectMeta, RetryDelayAnnotation, "")
+
+	if t := src.Spec.Timeout; t != nil {
+		dst.Spec.Timeout = wholeSeconds(t.Duration)
+		// 0 would be read back as no timeout
+		if t.Duration == 0 || time.Duration(dst.Spec.Timeout)*time.Second != t.Duration {
+			setAnnotation(&dst.ObjectMeta, TimeoutAnnotation, t.Duration.String())
+		}
+	}
+
+	kept := conversionData{
+		UDP:               src.Spec.UDP.DeepCopy(),
+		ICMP:              src.Spec.ICMP.DeepCopy(),
+		GRPC:              src.Spec.GRPC.DeepCopy(),
+		Ping:              src.Status.Ping.DeepCopy(),
+		ConnectionOutcome: src.Status.ConnectionOutcome,
+	}
+	if src.Spec.TCP != nil {
+		kept.TCPSteps = src.Spec.TCP.DeepCopy().Steps
+	}
+	if slices.Contains(v2.BlockedOutcomes, src.Spec.ExpectedOutcome) {
+		dst.Spec.ExpectedOutcome = OutcomeBlocked
+		kept.ExpectedOutcome = src.Spec.ExpectedOutcome
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	if string(data) != "{}" {
+		setAnnotation(&dst.ObjectMeta, ConversionDataAnnotation, string(data))
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = NetworktestStatus{
+		Active:               status.Active,
+		Conditions:           status.Conditions,
+		LastRun:              status.LastRun,
+		NextRun:              status.NextRun,
+		ConsecutiveSuccesses: status.ConsecutiveSuccesses,
+		ConsecutiveFailures:  status.ConsecutiveFailures,
+		FailureReason:        status.FailureReason,
+		LastTimings:          (*ProbeTimings)(status.LastTimings),
+	}
+	if status.LastResult != "" {
+		dst.Status.LastResult = &status.LastResult
+	}
+	if status.Message != "" {
+		dst.Status.Message = &status.Message
+	}
+	for _, h := range status.History {
+		dst.Status.History = append(dst.Status.History, ResultHistoryEntry(h))
+	}
+
+	return nil
+}
+
+// wholeSeconds rounds a timeout up to whole seconds, as sub-second timeouts cannot be represented in v1
+func wholeSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// copyBool returns a copy of the optional value, so the converted object does not share it with the source
+func copyBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	return &c
+}
+
+// durationTo converts a v1 duration to v2. The v1 duration is returned as well when it cannot be restored from the v2
+// duration, because it is not written the way v2 formats it, or is not a valid duration at all.
+func durationTo(s string) (*metav1.Duration, string) {
+	if s == "" {
+		return nil, ""
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, s
+	}
+	if d.String() == s {
+		return &metav1.Duration{Duration: d}, ""
+	}
+	return &metav1.Duration{Duration: d}, s
+}
+
+// durationFrom converts a v2 duration to v1, using the duration kept by durationTo when it is still the same duration
+func durationFrom(d *metav1.Duration, kept string) string {
+	if kept != "" {
+		k, err := time.ParseDuration(kept)
+		if (err != nil && d == nil) || (err == nil && d != nil && k == d.Duration) {
+			return kept
+		}
+	}
+
+	if d == nil {
+		return ""
+	}
+	return d.Duration.String()
+}
+
+// setAnnotation sets an annotation, or removes it when the value is empty
+func setAnnotation(meta *metav1.ObjectMeta, key string, value string) {
+	if value == "" {
+		delete(meta.Annotations, key)
+		if len(meta.Annotations) == 0 {
+			meta.Annotations = nil
+		}
+		return
+	}
+
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[key] = value
+}
+
+func convertHttpProbeTo(src *HttpProbe) *v2.HTTPProbe {
+	if src == nil {
+		return nil
+	}
+	src = src.DeepCopy()
+
+	dst := &v2.HTTPProbe{
+		URL:                     src.URL,
+		FailOnCodes:             src.FailOnCodes,
+		ExpectCodes:             src.ExpectCodes,
+		TLSSkipVerify:           src.TlsSkipVerify,
+		Method:                  src.Method,
+		RequestBody:             src.RequestBody,
+		RequestBodyFrom:         src.RequestBodyFrom,
+		Host:                    src.Host,
+		CABundle:                (*v2.CABundleSource)(src.CABundle),
+		ClientCertificateSecret: src.ClientCertificateSecret,
+	}
+	if src.Body != nil {
+		dst.Body = &v2.HTTPBodyAssertion{
+			Contains: src.Body.Contains,
+			Matches:  src.Body.Matches,
+			JSONPath: (*v2.JSONPathAssertion)(src.Body.JSONPath),
+			MaxBytes: src.Body.MaxBytes,
+		}
+	}
+	for _, h := range src.Headers {
+		dst.Headers = append(dst.Headers, v2.HTTPHeader(h))
+	}
+	return dst
+}
+
+func convertHttpProbeFrom(src *v2.HTTPProbe) *HttpProbe {
+	if src == nil {
+		return nil
+	}
+	src = src.DeepCopy()
+
+	dst := &HttpProbe{
+		URL:                     src.URL,
+		FailOnCodes:             src.FailOnCodes,
+		ExpectCodes:             src.ExpectCodes,
+		TlsSkipVerify:           src.TLSSkipVerify,
+		Method:                  src.Method,
+		RequestBody:             src.RequestBody,
+		RequestBodyFrom:         src.RequestBodyFrom,
+		Host:                    src.Host,
+		CABundle:                (*CABundleSource)(src.CABundle),
+		ClientCertificateSecret: src.ClientCertificateSecret,
+	}
+	if src.Body != nil {
+		dst.Body = &HttpBodyAssertion{
+			Contains: src.Body.Contains,
+			Matches:  src.Body.Matches,
+			JSONPath: (*JSONPathAssertion)(src.Body.JSONPath),
+			MaxBytes: src.Body.MaxBytes,
+		}
+	}
+	for _, h := range src.Headers {
+		dst.Headers = append(dst.Headers, HttpHeader(h))
+	}
+	return dst
+}
+
+func convertTCPProbeTo(src *TCPProbe) *v2.TCPProbe {
+	if src == nil {
+		return nil
+	}
+
+	return &v2.TCPProbe{
+		Address: src.Address,
+		Port:    src.Port,
+		Data:    src.Data,
+	}
+}
+
+func convertTCPProbeFrom(src *v2.TCPProbe) *TCPProbe {
+	if src == nil {
+		return nil
+	}
+
+	return &TCPProbe{
+		Address: src.Address,
+		Port:    src.Port,
+		Data:    src.Data,
+	}
+}
+
+func convertTLSProbeTo(src *TLSProbe) *v2.TLSProbe {
+	if src == nil {
+		return nil
+	}
+	src = src.DeepCopy()
+
+	return &v2.TLSProbe{
+		Address:                 src.Address,
+		Port:                    src.Port,
+		ServerName:              src.ServerName,
+		MinDaysUntilExpiry:      src.MinDaysUntilExpiry,
+		ExpectedIssuer:          src.ExpectedIssuer,
+		CABundle:                (*v2.CABundleSource)(src.CABundle),
+		ClientCertificateSecret: src.ClientCertificateSecret,
+	}
+}
+
+func convertTLSProbeFrom(src *v2.TLSProbe) *TLSProbe {
+	if src == nil {
+		return nil
+	}
+	src = src.DeepCopy()
+
+	return &TLSProbe{
+		Address:                 src.Address,
+		Port:                    src.Port,
+		ServerName:              src.ServerName,
+		MinDaysUntilExpiry:      src.MinDaysUntilExpiry,
+		ExpectedIssuer:          src.ExpectedIssuer,
+		CABundle:                (*CABundleSource)(src.CABundle),
+		ClientCertificateSecret: src.ClientCertificateSecret,
+	}
+}
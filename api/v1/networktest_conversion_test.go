@@ -0,0 +1,196 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/randfill"
+
+	v2 "edgeworks.no/networktester/api/v2"
+)
+
+const fuzzIterations = 1000
+
+func TestFuzzyConversion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	filler := fuzzer.FuzzerFor(fuzzer.MergeFuzzerFuncs(metafuzzer.Funcs, fuzzFuncs), rand.NewSource(seed), runtimeserializer.NewCodecFactory(scheme))
+
+	t.Run("v1 to v2 and back", func(t *testing.T) {
+		for i := 0; i < fuzzIterations; i++ {
+			spoke := &Networktest{}
+			filler.Fill(spoke)
+
+			hub := &v2.Networktest{}
+			if err := spoke.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			back := &Networktest{}
+			if err := back.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+
+			if !apiequality.Semantic.DeepEqual(spoke, back) {
+				t.Fatalf("round trip changed the object:\n%s", diff.ObjectReflectDiff(spoke, back))
+			}
+		}
+	})
+
+	t.Run("v2 to v1 and back", func(t *testing.T) {
+		for i := 0; i < fuzzIterations; i++ {
+			hub := &v2.Networktest{}
+			filler.Fill(hub)
+
+			spoke := &Networktest{}
+			if err := spoke.ConvertFrom(hub.DeepCopy()); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			back := &v2.Networktest{}
+			if err := spoke.ConvertTo(back); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+
+			if !apiequality.Semantic.DeepEqual(hub, back) {
+				t.Fatalf("round trip changed the object:\n%s", diff.ObjectReflectDiff(hub, back))
+			}
+		}
+	})
+}
+
+func TestConversionKeepsExplicitValues(t *testing.T) {
+	// The API server defaults the JSON returned by the conversion webhook, so a disabled test or a certificate
+	// check without minimum days must not be omitted as if they were not set
+	data := []byte(`{"spec":{"timeout":5,"enabled":false,"tls":{"address":"example.com","minDaysUntilExpiry":0}}}`)
+
+	spoke := &Networktest{}
+	if err := json.Unmarshal(data, spoke); err != nil {
+		t.Fatal(err)
+	}
+	hub := &v2.Networktest{}
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	expectExplicitValues(t, "v2", hub)
+
+	decoded := &v2.Networktest{}
+	if err := json.Unmarshal(mustMarshal(t, hub), decoded); err != nil {
+		t.Fatal(err)
+	}
+	back := &Networktest{}
+	if err := back.ConvertFrom(decoded); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	expectExplicitValues(t, "v1", back)
+}
+
+// expectExplicitValues checks that the JSON of the test still has enabled and minDaysUntilExpiry set to false and 0
+func expectExplicitValues(t *testing.T, version string, obj interface{}) {
+	t.Helper()
+	var converted struct {
+		Spec struct {
+			Enabled *bool `json:"enabled"`
+			TLS     struct {
+				MinDaysUntilExpiry *int `json:"minDaysUntilExpiry"`
+			} `json:"tls"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(mustMarshal(t, obj), &converted); err != nil {
+		t.Fatal(err)
+	}
+	if converted.Spec.Enabled == nil || *converted.Spec.Enabled {
+		t.Errorf("%s enabled = %v, want false", version, converted.Spec.Enabled)
+	}
+	if converted.Spec.TLS.MinDaysUntilExpiry == nil || *converted.Spec.TLS.MinDaysUntilExpiry != 0 {
+		t.Errorf("%s minDaysUntilExpiry = %v, want 0", version, converted.Spec.TLS.MinDaysUntilExpiry)
+	}
+}
+
+func mustMarshal(t *testing.T, obj interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fuzzFuncs keeps the fuzzed objects to values the API server could hold
+func fuzzFuncs(_ runtimeserializer.CodecFactory) []interface{} {
+	return []interface{}{
+		func(s *NetworktestSpec, c randfill.Continue) {
+			c.FillNoCustom(s)
+			s.Interval = fuzzDuration(c)
+			s.RetryDelay = fuzzDuration(c)
+			// Timeouts are limited by the duration they are converted to
+			s.Timeout = c.Intn(100000)
+		},
+		func(s *NetworktestStatus, c randfill.Continue) {
+			c.FillNoCustom(s)
+			// Empty strings are not distinguished from no value in v2
+			if s.LastResult != nil && *s.LastResult == "" {
+				s.LastResult = nil
+			}
+			if s.Message != nil && *s.Message == "" {
+				s.Message = nil
+			}
+		},
+		func(s *v2.NetworktestSpec, c randfill.Continue) {
+			c.FillNoCustom(s)
+			// Outcomes only available in v2 are not likely to be filled in at random
+			if c.Bool() {
+				s.ExpectedOutcome = v2.BlockedOutcomes[c.Intn(len(v2.BlockedOutcomes))]
+			}
+		},
+		func(d *metav1.Duration, c randfill.Continue) {
+			d.Duration = time.Duration(c.Int63n(int64(24*time.Hour))) - time.Hour
+		},
+	}
+}
+
+// fuzzDuration returns a v1 duration written the way v2 formats it, written another way, not valid, or empty
+func fuzzDuration(c randfill.Continue) string {
+	d := time.Duration(c.Int63n(int64(24 * time.Hour)))
+	switch c.Intn(4) {
+	case 0:
+		return d.String()
+	case 1:
+		return d.Round(time.Second).String() + "0ms"
+	case 2:
+		return c.String(10)
+	default:
+		return ""
+	}
+}
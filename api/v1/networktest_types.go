@@ -18,23 +18,38 @@ package v1
 
 import (
 	"fmt"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
 )
 
-// NetworktestSpec defines the desired state of Networktest
+// NetworktestSpec defines the desired state of Networktest. Probe types only available in v2 are kept in the conversion
+// data annotation, so a test may have none of the probes of v1. The validating webhook requires exactly one probe.
+// +kubebuilder:validation:XValidation:rule="[has(self.http), has(self.tcp), has(self.dns), has(self.tls)].filter(p, p).size() <= 1",message="only one of http, tcp, dns or tls can be specified"
 type NetworktestSpec struct {
 
 	// +kubebuilder:default:="1h"
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$') && duration(self) > duration('0s')",message="interval must be a duration greater than zero, like 30s, 5m or 1h"
 	// interval defines how often the probing will be done. Defaults to 1h. Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
 	Interval string `json:"interval"` // Default 1h
 
 	// +kubebuilder:default:=5
+	// +kubebuilder:validation:Minimum=1
 	// timeout in seconds until the probe is considered failed. Default is 5 seconds.
 	Timeout int `json:"timeout"`
 
 	// +kubebuilder:default:=true
+	// +optional
 	// enabled lets you disable rules without deleting them. Default true.
-	Enabled bool `json:"enabled,omitempty"`
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// +kubebuilder:validation:Enum=Allowed;Blocked
+	// +kubebuilder:default:=Allowed
+	// +optional
+	// expectedOutcome defines whether traffic is expected to get through (Allowed) or be stopped by a network policy
+	// or firewall (Blocked). With Blocked, a refused, reset or timed out connection is reported as success. Default Allowed.
+	ExpectedOutcome string `json:"expectedOutcome,omitempty"`
 
 	// +optional
 	// http defines settings for probing using http client
@@ -45,26 +60,173 @@ type NetworktestSpec struct {
 	TCP *TCPProbe `json:"tcp"`
 
 	// +optional
-	// limit number of probe result transitions to keep in the status. Default 0 - no limit.
+	// dns defines settings for probing using name lookups
+	DNS *DNSProbe `json:"dns"`
+
+	// +optional
+	// tls defines settings for inspecting the certificate of a TLS server
+	TLS *TLSProbe `json:"tls"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	// limit number of probe result transitions to keep in status.history. Default 0 - no limit.
 	HistoryLimit int `json:"historyLimit"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	// failureThreshold is the number of consecutive failed runs before the result changes to Failed. Default 1.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	// successThreshold is the number of consecutive successful runs before the result changes to Success. Default 1.
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	// retries is the number of times a failed probe is retried within a run before the run is considered failed. Default 0.
+	Retries int `json:"retries,omitempty"`
+
+	// +kubebuilder:default:="1s"
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$')",message="retryDelay must be a duration, like 500ms or 1s"
+	// +optional
+	// retryDelay is the time to wait between retries within a run. Default 1s.
+	RetryDelay string `json:"retryDelay,omitempty"`
 }
 
 type HttpProbe struct {
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:XValidation:rule="self.matches('^(?i)https?://[^/?#]+')",message="url must be an http or https URL with a host"
 	// url must be valid http/https url
 	URL string `json:"url"`
 
+	// +kubebuilder:validation:items:Minimum=100
+	// +kubebuilder:validation:items:Maximum=599
 	// failOnCodes lists the HTTP codes that should fail the test. Empty list means a successful HTTP request means the test is good.
+	// Takes precedence over expectCodes.
 	FailOnCodes []int `json:"failOnCodes,omitempty"`
 
+	// +optional
+	// expectCodes lists the HTTP codes that are accepted, given as exact codes ("200"), ranges ("200-299") or classes ("2xx").
+	// Any other code fails the test. Empty list means all codes not listed in failOnCodes are accepted.
+	ExpectCodes []string `json:"expectCodes,omitempty"`
+
 	// tlsSkipVerify allows optional https without verifying server certificate (default: false)
 	// +optional
 	TlsSkipVerify bool `json:"tlsSkipVerify,omitempty"`
+
+	// +optional
+	// body defines assertions on the response body. All given assertions must hold for the test to succeed.
+	Body *HttpBodyAssertion `json:"body,omitempty"`
+
+	// +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;PATCH;DELETE;OPTIONS
+	// +kubebuilder:default:=GET
+	// +optional
+	// method is the HTTP method of the request. Default GET.
+	Method string `json:"method,omitempty"`
+
+	// +optional
+	// headers to add to the request
+	Headers []HttpHeader `json:"headers,omitempty"`
+
+	// +optional
+	// requestBody is sent as the body of the request
+	RequestBody string `json:"requestBody,omitempty"`
+
+	// +optional
+	// requestBodyFrom reads the body of the request from a ConfigMap key in the namespace of the Networktest.
+	// Takes precedence over requestBody.
+	RequestBodyFrom *corev1.ConfigMapKeySelector `json:"requestBodyFrom,omitempty"`
+
+	// +optional
+	// host overrides the Host header and the TLS server name, for probing a virtual host through the address in the url
+	Host string `json:"host,omitempty"`
+
+	// +optional
+	// caBundle references PEM encoded CA certificates to trust in addition to the system roots
+	CABundle *CABundleSource `json:"caBundle,omitempty"`
+
+	// +optional
+	// clientCertificateSecret is the name of a Secret of type kubernetes.io/tls in the namespace of the Networktest,
+	// presented for client authentication
+	ClientCertificateSecret string `json:"clientCertificateSecret,omitempty"`
+}
+
+// CABundleSource references a key holding PEM encoded CA certificates. Exactly one of configMapKeyRef and secretKeyRef must be set.
+type CABundleSource struct {
+	// +optional
+	// configMapKeyRef selects a key of a ConfigMap in the namespace of the Networktest
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// +optional
+	// secretKeyRef selects a key of a Secret in the namespace of the Networktest
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+type HttpHeader struct {
+	// name of the header
+	Name string `json:"name"`
+
+	// +optional
+	// value of the header
+	Value string `json:"value,omitempty"`
+
+	// +optional
+	// valueFrom reads the value of the header from a Secret key in the namespace of the Networktest. Takes precedence over value.
+	ValueFrom *corev1.SecretKeySelector `json:"valueFrom,omitempty"`
+}
+
+func (p HttpProbe) GetMethod() string {
+	if p.Method == "" {
+		return "GET"
+	}
+	return p.Method
+}
+
+type HttpBodyAssertion struct {
+	// +optional
+	// contains is a string the response body must contain
+	Contains string `json:"contains,omitempty"`
+
+	// +optional
+	// matches is a regular expression the response body must match
+	Matches string `json:"matches,omitempty"`
+
+	// +optional
+	// jsonPath asserts on the value of a JSONPath expression evaluated on a JSON response body
+	JSONPath *JSONPathAssertion `json:"jsonPath,omitempty"`
+
+	// +kubebuilder:default:=65536
+	// +optional
+	// maxBytes limits how much of the response body is read. Default is 65536 bytes.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+}
+
+type JSONPathAssertion struct {
+	// expression in kubectl JSONPath syntax, e.g. "{.status}" or ".items[0].name"
+	Expression string `json:"expression"`
+
+	// value is the expected result of evaluating the expression
+	Value string `json:"value"`
+}
+
+func (b HttpBodyAssertion) GetMaxBytes() int64 {
+	if b.MaxBytes <= 0 {
+		return 65536
+	}
+	return b.MaxBytes
 }
 
 type TCPProbe struct {
+	// +kubebuilder:validation:MinLength=1
 	// address must be valid IP address or host name
 	Address string `json:"address"`
 
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
 	// port must be valid port
 	Port int `json:"port"`
 
@@ -72,16 +234,108 @@ type TCPProbe struct {
 	Data string `json:"data,omitempty"`
 }
 
+type DNSProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// name is the host name to look up
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Enum=A;AAAA;CNAME;MX;TXT;SRV
+	// +kubebuilder:default:=A
+	// +optional
+	// recordType is the type of record to look up. Default A.
+	RecordType string `json:"recordType,omitempty"`
+
+	// +optional
+	// nameserver to query, given as host or host:port. Empty means the resolver configured for the controller.
+	Nameserver string `json:"nameserver,omitempty"`
+
+	// +optional
+	// expectedAnswers lists records that must all be present in the answer. Empty list means any answer is good.
+	ExpectedAnswers []string `json:"expectedAnswers,omitempty"`
+}
+
+func (p DNSProbe) GetRecordType() string {
+	if p.RecordType == "" {
+		return "A"
+	}
+	return p.RecordType
+}
+
+type TLSProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// address must be valid IP address or host name
+	Address string `json:"address"`
+
+	// +kubebuilder:default:=443
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	// port must be valid port. Default 443.
+	Port int `json:"port,omitempty"`
+
+	// +optional
+	// serverName is sent as SNI and verified against the certificate. Defaults to the address.
+	ServerName string `json:"serverName,omitempty"`
+
+	// +kubebuilder:default:=14
+	// +optional
+	// minDaysUntilExpiry fails the test when the certificate expires in fewer days. Default 14.
+	MinDaysUntilExpiry *int `json:"minDaysUntilExpiry,omitempty"`
+
+	// +optional
+	// expectedIssuer fails the test unless the issuer of the certificate contains the given string, e.g. "CN=R3"
+	ExpectedIssuer string `json:"expectedIssuer,omitempty"`
+
+	// +optional
+	// caBundle references PEM encoded CA certificates to trust in addition to the system roots
+	CABundle *CABundleSource `json:"caBundle,omitempty"`
+
+	// +optional
+	// clientCertificateSecret is the name of a Secret of type kubernetes.io/tls in the namespace of the Networktest,
+	// presented for client authentication
+	ClientCertificateSecret string `json:"clientCertificateSecret,omitempty"`
+}
+
+func (p TLSProbe) GetPort() int {
+	if p.Port == 0 {
+		return 443
+	}
+	return p.Port
+}
+
+func (p TLSProbe) GetServerName() string {
+	if p.ServerName == "" {
+		return p.Address
+	}
+	return p.ServerName
+}
+
 func (s *NetworktestSpec) GetAddress() string {
 	if s.Http != nil {
 		return fmt.Sprintf("%s", s.Http.URL)
 	} else if s.TCP != nil {
 		return fmt.Sprintf("tcp://%s:%d", s.TCP.Address, s.TCP.Port)
+	} else if s.TLS != nil {
+		return fmt.Sprintf("tls://%s:%d", s.TLS.Address, s.TLS.GetPort())
+	} else if s.DNS != nil {
+		return fmt.Sprintf("dns://%s/%s?type=%s", s.DNS.Nameserver, s.DNS.Name, s.DNS.GetRecordType())
 	} else {
 		return "<undefined>"
 	}
 }
 
+const (
+	OutcomeAllowed = "Allowed"
+	OutcomeBlocked = "Blocked"
+)
+
+func (s NetworktestSpec) GetExpectedOutcome() string {
+	if s.ExpectedOutcome == "" {
+		return OutcomeAllowed
+	}
+	return s.ExpectedOutcome
+}
+
 func (s NetworktestSpec) GetInterval() string {
 	if s.Interval == "" {
 		return "1h"
@@ -89,10 +343,40 @@ func (s NetworktestSpec) GetInterval() string {
 	return s.Interval
 }
 
+func (s NetworktestSpec) GetFailureThreshold() int {
+	if s.FailureThreshold < 1 {
+		return 1
+	}
+	return s.FailureThreshold
+}
+
+func (s NetworktestSpec) GetSuccessThreshold() int {
+	if s.SuccessThreshold < 1 {
+		return 1
+	}
+	return s.SuccessThreshold
+}
+
+func (s NetworktestSpec) GetRetryDelay() time.Duration {
+	if d, err := time.ParseDuration(s.RetryDelay); err == nil {
+		return d
+	}
+	return time.Second
+}
+
 // NetworktestStatus defines the observed state of Networktest
 type NetworktestStatus struct {
-	Active     bool               `json:"active,omitempty"`
-	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Active bool `json:"active,omitempty"`
+
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// conditions holds the Ready condition, which is True when the last result is Success
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// +optional
+	// history holds the result transitions, oldest first, limited by historyLimit
+	History []ResultHistoryEntry `json:"history,omitempty"`
 
 	// +optional
 	LastRun *metav1.Time `json:"lastRun"`
@@ -105,12 +389,87 @@ type NetworktestStatus struct {
 
 	// +optional
 	Message *string `json:"message"`
+
+	// +optional
+	// consecutiveSuccesses is the number of successful runs in a row
+	ConsecutiveSuccesses int `json:"consecutiveSuccesses,omitempty"`
+
+	// +optional
+	// consecutiveFailures is the number of failed runs in a row
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// +optional
+	// failureReason classifies why the last run failed: timeout, refused, reset, unreachable, dns_error, tls_error,
+	// http_status, assertion, config or other. Empty when the last run succeeded.
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// +optional
+	// lastTimings is the duration of each phase of the last run
+	LastTimings *ProbeTimings `json:"lastTimings,omitempty"`
+}
+
+// ResultHistoryEntry records a change of result, or the first result after the spec changed
+type ResultHistoryEntry struct {
+	// time of the run
+	Time metav1.Time `json:"time"`
+
+	// result of the run, Success or Failed
+	Result string `json:"result"`
+
+	// +optional
+	// message of the run
+	Message string `json:"message,omitempty"`
+
+	// +optional
+	// latency is the duration of the run
+	Latency *metav1.Duration `json:"latency,omitempty"`
+
+	// +optional
+	// observedGeneration is the generation of the spec the run was performed with
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+const (
+	// ConditionReady is True when the last result is Success, and False when it is Failed or the test is not active
+	ConditionReady = "Ready"
+
+	// Reasons of the Ready condition
+	ReasonSucceeded   = "ProbeSucceeded"
+	ReasonFailed      = "ProbeFailed"
+	ReasonPending     = "Pending"
+	ReasonInvalidSpec = "InvalidSpec"
+	ReasonDisabled    = "Disabled"
+)
+
+// ProbeTimings holds the duration of each phase of a probe run. Phases that are not part of the probe are omitted.
+type ProbeTimings struct {
+	// +optional
+	// total is the duration of the whole probe
+	Total *metav1.Duration `json:"total,omitempty"`
+
+	// +optional
+	// dnsLookup is the time spent resolving the name of the target
+	DNSLookup *metav1.Duration `json:"dnsLookup,omitempty"`
+
+	// +optional
+	// connect is the time spent establishing the TCP connection
+	Connect *metav1.Duration `json:"connect,omitempty"`
+
+	// +optional
+	// tlsHandshake is the time spent on the TLS handshake
+	TLSHandshake *metav1.Duration `json:"tlsHandshake,omitempty"`
+
+	// +optional
+	// firstByte is the time from the request was started until the first byte of the response was received
+	FirstByte *metav1.Duration `json:"firstByte,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:JSONPath=".status.conditions[?(@.type==\"Ready\")].status",name=Ready,type=string
 //+kubebuilder:printcolumn:JSONPath=".status.lastResult",name=LastResult,type=string
 //+kubebuilder:printcolumn:JSONPath=".status.lastRun",name=LastRun,type=string
+//+kubebuilder:deprecatedversion:warning="edgeworks.no/v1 Networktest is deprecated, use edgeworks.no/v2"
 
 // Networktest is the Schema for the networktests API
 type Networktest struct {
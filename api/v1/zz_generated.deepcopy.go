@@ -22,10 +22,96 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CABundleSource) DeepCopyInto(out *CABundleSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CABundleSource.
+func (in *CABundleSource) DeepCopy() *CABundleSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CABundleSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSProbe) DeepCopyInto(out *DNSProbe) {
+	*out = *in
+	if in.ExpectedAnswers != nil {
+		in, out := &in.ExpectedAnswers, &out.ExpectedAnswers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSProbe.
+func (in *DNSProbe) DeepCopy() *DNSProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HttpBodyAssertion) DeepCopyInto(out *HttpBodyAssertion) {
+	*out = *in
+	if in.JSONPath != nil {
+		in, out := &in.JSONPath, &out.JSONPath
+		*out = new(JSONPathAssertion)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HttpBodyAssertion.
+func (in *HttpBodyAssertion) DeepCopy() *HttpBodyAssertion {
+	if in == nil {
+		return nil
+	}
+	out := new(HttpBodyAssertion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HttpHeader) DeepCopyInto(out *HttpHeader) {
+	*out = *in
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HttpHeader.
+func (in *HttpHeader) DeepCopy() *HttpHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(HttpHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HttpProbe) DeepCopyInto(out *HttpProbe) {
 	*out = *in
@@ -34,6 +120,33 @@ func (in *HttpProbe) DeepCopyInto(out *HttpProbe) {
 		*out = make([]int, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExpectCodes != nil {
+		in, out := &in.ExpectCodes, &out.ExpectCodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Body != nil {
+		in, out := &in.Body, &out.Body
+		*out = new(HttpBodyAssertion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]HttpHeader, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RequestBodyFrom != nil {
+		in, out := &in.RequestBodyFrom, &out.RequestBodyFrom
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundleSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HttpProbe.
@@ -46,6 +159,21 @@ func (in *HttpProbe) DeepCopy() *HttpProbe {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JSONPathAssertion) DeepCopyInto(out *JSONPathAssertion) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JSONPathAssertion.
+func (in *JSONPathAssertion) DeepCopy() *JSONPathAssertion {
+	if in == nil {
+		return nil
+	}
+	out := new(JSONPathAssertion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Networktest) DeepCopyInto(out *Networktest) {
 	*out = *in
@@ -108,6 +236,11 @@ func (in *NetworktestList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworktestSpec) DeepCopyInto(out *NetworktestSpec) {
 	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
 	if in.Http != nil {
 		in, out := &in.Http, &out.Http
 		*out = new(HttpProbe)
@@ -118,6 +251,16 @@ func (in *NetworktestSpec) DeepCopyInto(out *NetworktestSpec) {
 		*out = new(TCPProbe)
 		**out = **in
 	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(DNSProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSProbe)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworktestSpec.
@@ -140,6 +283,13 @@ func (in *NetworktestStatus) DeepCopyInto(out *NetworktestStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]ResultHistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.LastRun != nil {
 		in, out := &in.LastRun, &out.LastRun
 		*out = (*in).DeepCopy()
@@ -158,6 +308,11 @@ func (in *NetworktestStatus) DeepCopyInto(out *NetworktestStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.LastTimings != nil {
+		in, out := &in.LastTimings, &out.LastTimings
+		*out = new(ProbeTimings)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworktestStatus.
@@ -170,6 +325,67 @@ func (in *NetworktestStatus) DeepCopy() *NetworktestStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProbeTimings) DeepCopyInto(out *ProbeTimings) {
+	*out = *in
+	if in.Total != nil {
+		in, out := &in.Total, &out.Total
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.DNSLookup != nil {
+		in, out := &in.DNSLookup, &out.DNSLookup
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Connect != nil {
+		in, out := &in.Connect, &out.Connect
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.TLSHandshake != nil {
+		in, out := &in.TLSHandshake, &out.TLSHandshake
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FirstByte != nil {
+		in, out := &in.FirstByte, &out.FirstByte
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProbeTimings.
+func (in *ProbeTimings) DeepCopy() *ProbeTimings {
+	if in == nil {
+		return nil
+	}
+	out := new(ProbeTimings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResultHistoryEntry) DeepCopyInto(out *ResultHistoryEntry) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResultHistoryEntry.
+func (in *ResultHistoryEntry) DeepCopy() *ResultHistoryEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(ResultHistoryEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TCPProbe) DeepCopyInto(out *TCPProbe) {
 	*out = *in
@@ -184,3 +400,28 @@ func (in *TCPProbe) DeepCopy() *TCPProbe {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSProbe) DeepCopyInto(out *TLSProbe) {
+	*out = *in
+	if in.MinDaysUntilExpiry != nil {
+		in, out := &in.MinDaysUntilExpiry, &out.MinDaysUntilExpiry
+		*out = new(int)
+		**out = **in
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundleSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSProbe.
+func (in *TLSProbe) DeepCopy() *TLSProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSProbe)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:JSONPath=".status.conditions[?(@.type==\"Ready\")].status",name=Ready,type=string
+//+kubebuilder:printcolumn:JSONPath=".status.lastResult",name=LastResult,type=string
+//+kubebuilder:printcolumn:JSONPath=".status.lastRun",name=LastRun,type=string
+
+// ClusterNetworktest is the Schema for the clusternetworktests API. It is a Networktest not owned by any namespace.
+// Secrets and ConfigMaps it references are read from the namespace of the controller.
+type ClusterNetworktest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NetworktestSpec   `json:"spec,omitempty"`
+	Status NetworktestStatus `json:"status,omitempty"`
+}
+
+// GetSpec implements NetworktestObject
+func (t *ClusterNetworktest) GetSpec() *NetworktestSpec {
+	return &t.Spec
+}
+
+// GetStatus implements NetworktestObject
+func (t *ClusterNetworktest) GetStatus() *NetworktestStatus {
+	return &t.Status
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterNetworktestList contains a list of ClusterNetworktest
+type ClusterNetworktestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterNetworktest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterNetworktest{}, &ClusterNetworktestList{})
+}
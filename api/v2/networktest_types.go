@@ -0,0 +1,806 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"time"
+)
+
+// NetworktestSpec defines the desired state of Networktest
+// +kubebuilder:validation:XValidation:rule="[has(self.http), has(self.tcp), has(self.dns), has(self.tls), has(self.udp), has(self.icmp), has(self.grpc)].exists_one(p, p)",message="exactly one of http, tcp, udp, icmp, grpc, dns or tls must be specified"
+type NetworktestSpec struct {
+
+	// +kubebuilder:default:="1h"
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$') && duration(self) > duration('0s')",message="interval must be a duration greater than zero, like 30s, 5m or 1h"
+	// +optional
+	// interval defines how often the probing will be done. Defaults to 1h. Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// +kubebuilder:default:="5s"
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$') && duration(self) > duration('0s')",message="timeout must be a duration greater than zero, like 500ms or 5s"
+	// +optional
+	// timeout until the probe is considered failed. Default is 5s. Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// +kubebuilder:default:=true
+	// +optional
+	// enabled lets you disable rules without deleting them. Default true.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// +kubebuilder:validation:Enum=Allowed;Blocked;Refused;Reset;HostUnreachable;NetworkUnreachable;Filtered
+	// +kubebuilder:default:=Allowed
+	// +optional
+	// expectedOutcome defines whether traffic is expected to get through (Allowed) or be stopped by a network policy
+	// or firewall (Blocked). With Blocked, a refused, reset or timed out connection is reported as success. Default Allowed.
+	// tcp probes can require a particular outcome of the connection attempt instead of Blocked: Refused, Reset,
+	// HostUnreachable, NetworkUnreachable or Filtered, where Filtered means the attempt timed out without an answer.
+	ExpectedOutcome string `json:"expectedOutcome,omitempty"`
+
+	// +optional
+	// http defines settings for probing using http client
+	HTTP *HTTPProbe `json:"http,omitempty"`
+
+	// +optional
+	// tcp defines settings for probing using plain sockets
+	TCP *TCPProbe `json:"tcp,omitempty"`
+
+	// +optional
+	// dns defines settings for probing using name lookups
+	DNS *DNSProbe `json:"dns,omitempty"`
+
+	// +optional
+	// tls defines settings for inspecting the certificate of a TLS server
+	TLS *TLSProbe `json:"tls,omitempty"`
+
+	// +optional
+	// udp defines settings for probing by sending a datagram, optionally waiting for a response
+	UDP *UDPProbe `json:"udp,omitempty"`
+
+	// +optional
+	// icmp defines settings for probing by sending echo requests (ping)
+	ICMP *ICMPProbe `json:"icmp,omitempty"`
+
+	// +optional
+	// grpc defines settings for probing using the gRPC health checking protocol
+	GRPC *GRPCProbe `json:"grpc,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	// limit number of probe result transitions to keep in status.history. Default 0 - no limit.
+	HistoryLimit int `json:"historyLimit,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	// failureThreshold is the number of consecutive failed runs before the result changes to Failed. Default 1.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	// successThreshold is the number of consecutive successful runs before the result changes to Success. Default 1.
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	// retries is the number of times a failed probe is retried within a run before the run is considered failed. Default 0.
+	Retries int `json:"retries,omitempty"`
+
+	// +kubebuilder:default:="1s"
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$')",message="retryDelay must be a duration, like 500ms or 1s"
+	// +optional
+	// retryDelay is the time to wait between retries within a run. Default 1s.
+	RetryDelay *metav1.Duration `json:"retryDelay,omitempty"`
+}
+
+type HTTPProbe struct {
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:XValidation:rule="self.matches('^(?i)https?://[^/?#]+')",message="url must be an http or https URL with a host"
+	// url must be valid http/https url
+	URL string `json:"url"`
+
+	// +kubebuilder:validation:items:Minimum=100
+	// +kubebuilder:validation:items:Maximum=599
+	// failOnCodes lists the HTTP codes that should fail the test. Empty list means a successful HTTP request means the test is good.
+	// Takes precedence over expectCodes.
+	FailOnCodes []int `json:"failOnCodes,omitempty"`
+
+	// +optional
+	// expectCodes lists the HTTP codes that are accepted, given as exact codes ("200"), ranges ("200-299") or classes ("2xx").
+	// Any other code fails the test. Empty list means all codes not listed in failOnCodes are accepted.
+	ExpectCodes []string `json:"expectCodes,omitempty"`
+
+	// tlsSkipVerify allows optional https without verifying server certificate (default: false)
+	// +optional
+	TLSSkipVerify bool `json:"tlsSkipVerify,omitempty"`
+
+	// +optional
+	// body defines assertions on the response body. All given assertions must hold for the test to succeed.
+	Body *HTTPBodyAssertion `json:"body,omitempty"`
+
+	// +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;PATCH;DELETE;OPTIONS
+	// +kubebuilder:default:=GET
+	// +optional
+	// method is the HTTP method of the request. Default GET.
+	Method string `json:"method,omitempty"`
+
+	// +optional
+	// headers to add to the request
+	Headers []HTTPHeader `json:"headers,omitempty"`
+
+	// +optional
+	// requestBody is sent as the body of the request
+	RequestBody string `json:"requestBody,omitempty"`
+
+	// +optional
+	// requestBodyFrom reads the body of the request from a ConfigMap key in the namespace of the Networktest.
+	// Takes precedence over requestBody.
+	RequestBodyFrom *corev1.ConfigMapKeySelector `json:"requestBodyFrom,omitempty"`
+
+	// +optional
+	// host overrides the Host header and the TLS server name, for probing a virtual host through the address in the url
+	Host string `json:"host,omitempty"`
+
+	// +optional
+	// caBundle references PEM encoded CA certificates to trust in addition to the system roots
+	CABundle *CABundleSource `json:"caBundle,omitempty"`
+
+	// +optional
+	// clientCertificateSecret is the name of a Secret of type kubernetes.io/tls in the namespace of the Networktest,
+	// presented for client authentication
+	ClientCertificateSecret string `json:"clientCertificateSecret,omitempty"`
+}
+
+// CABundleSource references a key holding PEM encoded CA certificates. Exactly one of configMapKeyRef and secretKeyRef must be set.
+type CABundleSource struct {
+	// +optional
+	// configMapKeyRef selects a key of a ConfigMap in the namespace of the Networktest
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// +optional
+	// secretKeyRef selects a key of a Secret in the namespace of the Networktest
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+type HTTPHeader struct {
+	// name of the header
+	Name string `json:"name"`
+
+	// +optional
+	// value of the header
+	Value string `json:"value,omitempty"`
+
+	// +optional
+	// valueFrom reads the value of the header from a Secret key in the namespace of the Networktest. Takes precedence over value.
+	ValueFrom *corev1.SecretKeySelector `json:"valueFrom,omitempty"`
+}
+
+func (p HTTPProbe) GetMethod() string {
+	if p.Method == "" {
+		return "GET"
+	}
+	return p.Method
+}
+
+type HTTPBodyAssertion struct {
+	// +optional
+	// contains is a string the response body must contain
+	Contains string `json:"contains,omitempty"`
+
+	// +optional
+	// matches is a regular expression the response body must match
+	Matches string `json:"matches,omitempty"`
+
+	// +optional
+	// jsonPath asserts on the value of a JSONPath expression evaluated on a JSON response body
+	JSONPath *JSONPathAssertion `json:"jsonPath,omitempty"`
+
+	// +kubebuilder:default:=65536
+	// +optional
+	// maxBytes limits how much of the response body is read. Default is 65536 bytes.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+}
+
+type JSONPathAssertion struct {
+	// expression in kubectl JSONPath syntax, e.g. "{.status}" or ".items[0].name"
+	Expression string `json:"expression"`
+
+	// value is the expected result of evaluating the expression
+	Value string `json:"value"`
+}
+
+func (b HTTPBodyAssertion) GetMaxBytes() int64 {
+	if b.MaxBytes <= 0 {
+		return 65536
+	}
+	return b.MaxBytes
+}
+
+type TCPProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// address must be valid IP address or host name
+	Address string `json:"address"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// port must be valid port
+	Port int `json:"port"`
+
+	// +optional
+	// data is written to the connection after connecting, before the steps
+	Data string `json:"data,omitempty"`
+
+	// +kubebuilder:validation:MaxItems=20
+	// +optional
+	// steps is a conversation held with the target after connecting, run in order. Each step waits for the data
+	// received to match expect, then writes send. Use it to verify the banner or response of a protocol, like SSH, SMTP
+	// or Redis, rather than only that the connection is accepted.
+	Steps []TCPStep `json:"steps,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="has(self.expect) || has(self.send)",message="each step must have expect, send or both"
+type TCPStep struct {
+	// +optional
+	// expect is a regular expression the data received since the previous match must match. Empty means the step does
+	// not wait for data.
+	Expect string `json:"expect,omitempty"`
+
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$') && duration(self) > duration('0s')",message="readTimeout must be a duration greater than zero, like 500ms or 2s"
+	// +optional
+	// readTimeout is the longest time to wait for expect to match. The test timeout still applies. Default the time
+	// left until the test times out.
+	ReadTimeout *metav1.Duration `json:"readTimeout,omitempty"`
+
+	// +optional
+	// send is written to the connection once expect has matched, written as given by encoding
+	Send string `json:"send,omitempty"`
+
+	// +kubebuilder:validation:Enum=text;hex;base64
+	// +kubebuilder:default:=text
+	// +optional
+	// encoding of send: text, hex or base64. Default text.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func (s TCPStep) GetEncoding() string {
+	if s.Encoding == "" {
+		return EncodingText
+	}
+	return s.Encoding
+}
+
+type UDPProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// address must be valid IP address or host name
+	Address string `json:"address"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// port must be valid port
+	Port int `json:"port"`
+
+	// +optional
+	// payload is the datagram sent to the address, written as given by encoding. Empty sends an empty datagram.
+	Payload string `json:"payload,omitempty"`
+
+	// +kubebuilder:validation:Enum=text;hex;base64
+	// +kubebuilder:default:=text
+	// +optional
+	// encoding of the payload: text, hex or base64. Default text.
+	Encoding string `json:"encoding,omitempty"`
+
+	// +optional
+	// expectResponse waits for a response within the timeout. Without it, the test succeeds when the datagram is sent,
+	// as UDP gives no acknowledgement of datagrams received.
+	ExpectResponse *UDPResponseAssertion `json:"expectResponse,omitempty"`
+}
+
+type UDPResponseAssertion struct {
+	// +optional
+	// matches is a regular expression the response must match. Empty means any response is good.
+	Matches string `json:"matches,omitempty"`
+}
+
+func (p UDPProbe) GetEncoding() string {
+	if p.Encoding == "" {
+		return EncodingText
+	}
+	return p.Encoding
+}
+
+const (
+	// Encodings of payloads sent by probes
+	EncodingText   = "text"
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+type ICMPProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// address must be valid IP address or host name
+	Address string `json:"address"`
+
+	// +kubebuilder:default:=5
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	// count is the number of echo requests sent in each run. Default 5.
+	Count int `json:"count,omitempty"`
+
+	// +kubebuilder:default:="200ms"
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$') && duration(self) > duration('0s')",message="packetInterval must be a duration greater than zero, like 200ms or 1s"
+	// +optional
+	// packetInterval is the time between echo requests. All requests must be sent within the timeout. Default 200ms.
+	PacketInterval *metav1.Duration `json:"packetInterval,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	// maxPacketLoss is the highest percentage of echo requests without reply for the test to succeed. Default 0, no
+	// loss allowed. The test always fails when no reply is received.
+	MaxPacketLoss int `json:"maxPacketLoss,omitempty"`
+
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$')",message="maxRTT must be a duration, like 50ms"
+	// +optional
+	// maxRTT is the highest average round trip time for the test to succeed. Empty means no limit.
+	MaxRTT *metav1.Duration `json:"maxRTT,omitempty"`
+
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self.matches('^([0-9]+([.][0-9]+)?(ns|us|µs|ms|s|m|h))+$')",message="maxJitter must be a duration, like 10ms"
+	// +optional
+	// maxJitter is the highest jitter, the mean difference between consecutive round trip times, for the test to
+	// succeed. Empty means no limit.
+	MaxJitter *metav1.Duration `json:"maxJitter,omitempty"`
+}
+
+func (p ICMPProbe) GetCount() int {
+	if p.Count <= 0 {
+		return 5
+	}
+	return p.Count
+}
+
+func (p ICMPProbe) GetPacketInterval() time.Duration {
+	if p.PacketInterval == nil {
+		return 200 * time.Millisecond
+	}
+	return p.PacketInterval.Duration
+}
+
+type GRPCProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// address must be valid IP address or host name
+	Address string `json:"address"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// port must be valid port
+	Port int `json:"port"`
+
+	// +optional
+	// service is the name of the service to check, as registered with the health server. Empty checks the overall
+	// health of the server.
+	Service string `json:"service,omitempty"`
+
+	// +optional
+	// tls connects using TLS. Default false, connecting in plaintext.
+	TLS bool `json:"tls,omitempty"`
+
+	// +optional
+	// tlsSkipVerify connects using TLS without verifying the server certificate (default: false)
+	TLSSkipVerify bool `json:"tlsSkipVerify,omitempty"`
+
+	// +optional
+	// serverName is sent as SNI and verified against the certificate. Defaults to the address.
+	ServerName string `json:"serverName,omitempty"`
+
+	// +optional
+	// metadata to send with the health check, like authorization
+	Metadata []HTTPHeader `json:"metadata,omitempty"`
+
+	// +optional
+	// caBundle references PEM encoded CA certificates to trust in addition to the system roots
+	CABundle *CABundleSource `json:"caBundle,omitempty"`
+
+	// +optional
+	// clientCertificateSecret is the name of a Secret of type kubernetes.io/tls in the namespace of the Networktest,
+	// presented for client authentication
+	ClientCertificateSecret string `json:"clientCertificateSecret,omitempty"`
+}
+
+type DNSProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// name is the host name to look up
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Enum=A;AAAA;CNAME;MX;TXT;SRV
+	// +kubebuilder:default:=A
+	// +optional
+	// recordType is the type of record to look up. Default A.
+	RecordType string `json:"recordType,omitempty"`
+
+	// +optional
+	// nameserver to query, given as host or host:port. Empty means the resolver configured for the controller.
+	Nameserver string `json:"nameserver,omitempty"`
+
+	// +optional
+	// expectedAnswers lists records that must all be present in the answer. Empty list means any answer is good.
+	ExpectedAnswers []string `json:"expectedAnswers,omitempty"`
+}
+
+func (p DNSProbe) GetRecordType() string {
+	if p.RecordType == "" {
+		return "A"
+	}
+	return p.RecordType
+}
+
+type TLSProbe struct {
+	// +kubebuilder:validation:MinLength=1
+	// address must be valid IP address or host name
+	Address string `json:"address"`
+
+	// +kubebuilder:default:=443
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	// port must be valid port. Default 443.
+	Port int `json:"port,omitempty"`
+
+	// +optional
+	// serverName is sent as SNI and verified against the certificate. Defaults to the address.
+	ServerName string `json:"serverName,omitempty"`
+
+	// +kubebuilder:default:=14
+	// +optional
+	// minDaysUntilExpiry fails the test when the certificate expires in fewer days. Default 14.
+	MinDaysUntilExpiry *int `json:"minDaysUntilExpiry,omitempty"`
+
+	// +optional
+	// expectedIssuer fails the test unless the issuer of the certificate contains the given string, e.g. "CN=R3"
+	ExpectedIssuer string `json:"expectedIssuer,omitempty"`
+
+	// +optional
+	// caBundle references PEM encoded CA certificates to trust in addition to the system roots
+	CABundle *CABundleSource `json:"caBundle,omitempty"`
+
+	// +optional
+	// clientCertificateSecret is the name of a Secret of type kubernetes.io/tls in the namespace of the Networktest,
+	// presented for client authentication
+	ClientCertificateSecret string `json:"clientCertificateSecret,omitempty"`
+}
+
+func (p TLSProbe) GetPort() int {
+	if p.Port == 0 {
+		return 443
+	}
+	return p.Port
+}
+
+func (p TLSProbe) GetMinDaysUntilExpiry() int {
+	if p.MinDaysUntilExpiry == nil {
+		return 14
+	}
+	return *p.MinDaysUntilExpiry
+}
+
+func (p TLSProbe) GetServerName() string {
+	if p.ServerName == "" {
+		return p.Address
+	}
+	return p.ServerName
+}
+
+func (s *NetworktestSpec) GetAddress() string {
+	if s.HTTP != nil {
+		return s.HTTP.URL
+	} else if s.TCP != nil {
+		return fmt.Sprintf("tcp://%s:%d", s.TCP.Address, s.TCP.Port)
+	} else if s.TLS != nil {
+		return fmt.Sprintf("tls://%s:%d", s.TLS.Address, s.TLS.GetPort())
+	} else if s.UDP != nil {
+		return fmt.Sprintf("udp://%s:%d", s.UDP.Address, s.UDP.Port)
+	} else if s.ICMP != nil {
+		return fmt.Sprintf("icmp://%s", s.ICMP.Address)
+	} else if s.GRPC != nil {
+		return fmt.Sprintf("grpc://%s:%d/%s", s.GRPC.Address, s.GRPC.Port, s.GRPC.Service)
+	} else if s.DNS != nil {
+		return fmt.Sprintf("dns://%s/%s?type=%s", s.DNS.Nameserver, s.DNS.Name, s.DNS.GetRecordType())
+	} else {
+		return "<undefined>"
+	}
+}
+
+const (
+	OutcomeAllowed = "Allowed"
+	OutcomeBlocked = "Blocked"
+)
+
+const (
+	// Outcomes of the connection attempt of a tcp probe, shown in status.connectionOutcome
+	OutcomeConnected          = "Connected"
+	OutcomeRefused            = "Refused"
+	OutcomeReset              = "Reset"
+	OutcomeHostUnreachable    = "HostUnreachable"
+	OutcomeNetworkUnreachable = "NetworkUnreachable"
+	OutcomeFiltered           = "Filtered"
+)
+
+// BlockedOutcomes are the outcomes of a connection attempt where the traffic did not get through. A tcp probe can
+// expect one of them instead of Blocked.
+var BlockedOutcomes = []string{OutcomeRefused, OutcomeReset, OutcomeHostUnreachable, OutcomeNetworkUnreachable, OutcomeFiltered}
+
+func (s NetworktestSpec) GetEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+func (s NetworktestSpec) GetExpectedOutcome() string {
+	if s.ExpectedOutcome == "" {
+		return OutcomeAllowed
+	}
+	return s.ExpectedOutcome
+}
+
+func (s NetworktestSpec) GetInterval() time.Duration {
+	if s.Interval == nil {
+		return time.Hour
+	}
+	return s.Interval.Duration
+}
+
+func (s NetworktestSpec) GetTimeout() time.Duration {
+	if s.Timeout == nil {
+		return 5 * time.Second
+	}
+	return s.Timeout.Duration
+}
+
+func (s NetworktestSpec) GetFailureThreshold() int {
+	if s.FailureThreshold < 1 {
+		return 1
+	}
+	return s.FailureThreshold
+}
+
+func (s NetworktestSpec) GetSuccessThreshold() int {
+	if s.SuccessThreshold < 1 {
+		return 1
+	}
+	return s.SuccessThreshold
+}
+
+func (s NetworktestSpec) GetRetryDelay() time.Duration {
+	if s.RetryDelay == nil {
+		return time.Second
+	}
+	return s.RetryDelay.Duration
+}
+
+// NetworktestStatus defines the observed state of Networktest
+type NetworktestStatus struct {
+	// +optional
+	// active is true when the test is accepted and run
+	Active bool `json:"active,omitempty"`
+
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// conditions holds the Ready condition, which is True when the last result is Success
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// +optional
+	// history holds the result transitions, oldest first, limited by historyLimit
+	History []ResultHistoryEntry `json:"history,omitempty"`
+
+	// +optional
+	// lastRun is the time of the last run
+	LastRun *metav1.Time `json:"lastRun,omitempty"`
+
+	// +optional
+	// nextRun is the time the next run is due
+	NextRun *metav1.Time `json:"nextRun,omitempty"`
+
+	// +optional
+	// lastResult is the result of the last run, Success or Failed
+	LastResult string `json:"lastResult,omitempty"`
+
+	// +optional
+	// message describes the last result, or why the test is not active
+	Message string `json:"message,omitempty"`
+
+	// +optional
+	// consecutiveSuccesses is the number of successful runs in a row
+	ConsecutiveSuccesses int `json:"consecutiveSuccesses,omitempty"`
+
+	// +optional
+	// consecutiveFailures is the number of failed runs in a row
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// +optional
+	// failureReason classifies why the last run failed: timeout, refused, reset, unreachable, dns_error, tls_error,
+	// http_status, assertion, config or other. Empty when the last run succeeded.
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// +optional
+	// connectionOutcome is how the connection attempt of the last run of a tcp probe ended: Connected, Refused, Reset,
+	// HostUnreachable, NetworkUnreachable or Filtered. Empty when it ended otherwise, like a failed name lookup.
+	ConnectionOutcome string `json:"connectionOutcome,omitempty"`
+
+	// +optional
+	// lastTimings is the duration of each phase of the last run
+	LastTimings *ProbeTimings `json:"lastTimings,omitempty"`
+
+	// +optional
+	// ping holds the packet loss and round trip times of the last run of an icmp probe
+	Ping *PingStatistics `json:"ping,omitempty"`
+}
+
+// PingStatistics are the packet loss and round trip times of a run of an ICMP probe
+type PingStatistics struct {
+	// sent is the number of echo requests sent
+	Sent int `json:"sent"`
+
+	// received is the number of echo replies received
+	Received int `json:"received"`
+
+	// packetLoss is the percentage of echo requests without reply, rounded to a whole percent
+	PacketLoss int `json:"packetLoss"`
+
+	// +optional
+	// minRTT is the shortest round trip time
+	MinRTT *metav1.Duration `json:"minRTT,omitempty"`
+
+	// +optional
+	// avgRTT is the average round trip time
+	AvgRTT *metav1.Duration `json:"avgRTT,omitempty"`
+
+	// +optional
+	// maxRTT is the longest round trip time
+	MaxRTT *metav1.Duration `json:"maxRTT,omitempty"`
+
+	// +optional
+	// jitter is the mean difference between consecutive round trip times
+	Jitter *metav1.Duration `json:"jitter,omitempty"`
+}
+
+// ResultHistoryEntry records a change of result, or the first result after the spec changed
+type ResultHistoryEntry struct {
+	// time of the run
+	Time metav1.Time `json:"time"`
+
+	// result of the run, Success or Failed
+	Result string `json:"result"`
+
+	// +optional
+	// message of the run
+	Message string `json:"message,omitempty"`
+
+	// +optional
+	// latency is the duration of the run
+	Latency *metav1.Duration `json:"latency,omitempty"`
+
+	// +optional
+	// observedGeneration is the generation of the spec the run was performed with
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+const (
+	// ConditionReady is True when the last result is Success, and False when it is Failed or the test is not active
+	ConditionReady = "Ready"
+
+	// Reasons of the Ready condition
+	ReasonSucceeded   = "ProbeSucceeded"
+	ReasonFailed      = "ProbeFailed"
+	ReasonPending     = "Pending"
+	ReasonInvalidSpec = "InvalidSpec"
+	ReasonDisabled    = "Disabled"
+
+	// ConditionClamped is True when the interval or timeout is outside the limits of the controller, and the limits
+	// are used instead
+	ConditionClamped = "Clamped"
+
+	// ReasonOutsideLimits is the reason of the Clamped condition, and of the Ready condition when tests outside the
+	// limits are rejected
+	ReasonOutsideLimits = "OutsideLimits"
+)
+
+// ProbeTimings holds the duration of each phase of a probe run. Phases that are not part of the probe are omitted.
+type ProbeTimings struct {
+	// +optional
+	// total is the duration of the whole probe
+	Total *metav1.Duration `json:"total,omitempty"`
+
+	// +optional
+	// dnsLookup is the time spent resolving the name of the target
+	DNSLookup *metav1.Duration `json:"dnsLookup,omitempty"`
+
+	// +optional
+	// connect is the time spent establishing the TCP connection
+	Connect *metav1.Duration `json:"connect,omitempty"`
+
+	// +optional
+	// tlsHandshake is the time spent on the TLS handshake
+	TLSHandshake *metav1.Duration `json:"tlsHandshake,omitempty"`
+
+	// +optional
+	// firstByte is the time from the request was started until the first byte of the response was received
+	FirstByte *metav1.Duration `json:"firstByte,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:JSONPath=".status.conditions[?(@.type==\"Ready\")].status",name=Ready,type=string
+//+kubebuilder:printcolumn:JSONPath=".status.lastResult",name=LastResult,type=string
+//+kubebuilder:printcolumn:JSONPath=".status.lastRun",name=LastRun,type=string
+
+// Networktest is the Schema for the networktests API
+type Networktest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NetworktestSpec   `json:"spec,omitempty"`
+	Status NetworktestStatus `json:"status,omitempty"`
+}
+
+// GetSpec implements NetworktestObject
+func (t *Networktest) GetSpec() *NetworktestSpec {
+	return &t.Spec
+}
+
+// GetStatus implements NetworktestObject
+func (t *Networktest) GetStatus() *NetworktestStatus {
+	return &t.Status
+}
+
+// NetworktestObject is implemented by Networktest and ClusterNetworktest, which share spec and status
+type NetworktestObject interface {
+	metav1.Object
+	runtime.Object
+	GetSpec() *NetworktestSpec
+	GetStatus() *NetworktestStatus
+}
+
+//+kubebuilder:object:root=true
+
+// NetworktestList contains a list of Networktest
+type NetworktestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Networktest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Networktest{}, &NetworktestList{})
+}
@@ -60,3 +60,39 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Serving certificate of the webhooks, when it is not issued by cert-manager. The certificate in the existing Secret is
+kept, so upgrades do not change the CA bundle of the webhook configurations. It is generated once per release, as all
+templates must use the same certificate.
+*/}}
+{{- define "networktester.webhookCertificate" -}}
+{{- if not (hasKey .Values.webhook "generatedCertificate") }}
+{{- $service := printf "%s-webhook" (include "networktester.fullname" .) }}
+{{- $secret := lookup "v1" "Secret" .Release.Namespace (printf "%s-cert" $service) }}
+{{- $certificate := dict }}
+{{- if and $secret (hasKey $secret.data "ca.crt") }}
+{{- $certificate = dict "ca" (index $secret.data "ca.crt") "cert" (index $secret.data "tls.crt") "key" (index $secret.data "tls.key") }}
+{{- else }}
+{{- $ca := genCA (printf "%s-ca" $service) 3650 }}
+{{- $dnsNames := list (printf "%s.%s.svc" $service .Release.Namespace) (printf "%s.%s.svc.cluster.local" $service .Release.Namespace) }}
+{{- $cert := genSignedCert $service nil $dnsNames 3650 $ca }}
+{{- $certificate = dict "ca" ($ca.Cert | b64enc) "cert" ($cert.Cert | b64enc) "key" ($cert.Key | b64enc) }}
+{{- end }}
+{{- $_ := set .Values.webhook "generatedCertificate" $certificate }}
+{{- end }}
+{{- toYaml .Values.webhook.generatedCertificate }}
+{{- end }}
+
+{{/*
+Client config of a webhook, with the CA bundle to verify the serving certificate unless cert-manager injects it
+*/}}
+{{- define "networktester.webhookClientConfig" -}}
+service:
+  name: {{ include "networktester.fullname" .context }}-webhook
+  namespace: {{ .context.Release.Namespace }}
+  path: {{ .path }}
+{{- if not .context.Values.webhook.certManager }}
+caBundle: {{ (include "networktester.webhookCertificate" .context | fromYaml).ca }}
+{{- end }}
+{{- end }}
@@ -0,0 +1,288 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	edgeworksnov1 "edgeworks.no/networktester/api/v1"
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+var _ = Describe("Networktest admission", func() {
+	ctx := context.Background()
+
+	newTest := func(name string, spec edgeworksnov2.NetworktestSpec) *edgeworksnov2.Networktest {
+		return &edgeworksnov2.Networktest{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       spec,
+		}
+	}
+
+	newV1Test := func(name string, spec edgeworksnov1.NetworktestSpec) *edgeworksnov1.Networktest {
+		return &edgeworksnov1.Networktest{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       spec,
+		}
+	}
+
+	expectInvalid := func(t client.Object, message string) {
+		err := k8sClient.Create(ctx, t)
+		Expect(k8errors.IsInvalid(err)).To(BeTrue(), "expected invalid, got %v", err)
+		Expect(err.Error()).To(ContainSubstring(message))
+	}
+
+	Context("defaulting webhook", func() {
+		It("normalizes http tests", func() {
+			t := newTest("defaults-http", edgeworksnov2.NetworktestSpec{
+				Interval: &metav1.Duration{Duration: time.Minute},
+				HTTP:     &edgeworksnov2.HTTPProbe{URL: "HTTPS://Example.com/Path"},
+			})
+			Expect(k8sClient.Create(ctx, t)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, t)
+
+			Expect(t.Spec.GetTimeout()).To(Equal(5 * time.Second))
+			Expect(t.Spec.ExpectedOutcome).To(Equal(edgeworksnov2.OutcomeAllowed))
+			Expect(t.Spec.HTTP.URL).To(Equal("https://Example.com/Path"))
+			Expect(t.Spec.HTTP.Method).To(Equal("GET"))
+		})
+
+		It("normalizes cluster tests", func() {
+			t := &edgeworksnov2.ClusterNetworktest{
+				ObjectMeta: metav1.ObjectMeta{Name: "defaults-cluster"},
+				Spec: edgeworksnov2.NetworktestSpec{
+					TLS: &edgeworksnov2.TLSProbe{Address: "registry.example.com"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, t)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, t)
+
+			Expect(t.Spec.GetTimeout()).To(Equal(5 * time.Second))
+			Expect(t.Spec.TLS.Port).To(Equal(443))
+		})
+
+		It("fills in default ports", func() {
+			tlsTest := newTest("defaults-tls", edgeworksnov2.NetworktestSpec{
+				TLS: &edgeworksnov2.TLSProbe{Address: "example.com"},
+			})
+			Expect(k8sClient.Create(ctx, tlsTest)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, tlsTest)
+			Expect(tlsTest.Spec.Interval).To(Equal(&metav1.Duration{Duration: time.Hour}))
+			Expect(tlsTest.Spec.TLS.Port).To(Equal(443))
+
+			dnsTest := newTest("defaults-dns", edgeworksnov2.NetworktestSpec{
+				DNS: &edgeworksnov2.DNSProbe{Name: "example.com", Nameserver: "10.0.0.10"},
+			})
+			Expect(k8sClient.Create(ctx, dnsTest)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, dnsTest)
+			Expect(dnsTest.Spec.DNS.Nameserver).To(Equal("10.0.0.10:53"))
+			Expect(dnsTest.Spec.DNS.RecordType).To(Equal("A"))
+		})
+	})
+
+	Context("validating webhook", func() {
+		It("rejects invalid expectCodes", func() {
+			expectInvalid(newTest("invalid-codes", edgeworksnov2.NetworktestSpec{
+				HTTP: &edgeworksnov2.HTTPProbe{URL: "https://example.com", ExpectCodes: []string{"2xx", "abc"}},
+			}), "spec.http.expectCodes")
+		})
+
+		It("rejects invalid body assertions", func() {
+			expectInvalid(newTest("invalid-body", edgeworksnov2.NetworktestSpec{
+				HTTP: &edgeworksnov2.HTTPProbe{
+					URL:  "https://example.com",
+					Body: &edgeworksnov2.HTTPBodyAssertion{Matches: "("},
+				},
+			}), "invalid regular expression")
+		})
+
+		It("rejects updates making the test invalid", func() {
+			t := newTest("invalid-update", edgeworksnov2.NetworktestSpec{
+				HTTP: &edgeworksnov2.HTTPProbe{URL: "https://example.com"},
+			})
+			Expect(k8sClient.Create(ctx, t)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, t)
+
+			t.Spec.HTTP.Headers = []edgeworksnov2.HTTPHeader{{Name: ""}}
+			err := k8sClient.Update(ctx, t)
+			Expect(k8errors.IsInvalid(err)).To(BeTrue(), "expected invalid, got %v", err)
+			Expect(err.Error()).To(ContainSubstring("header name is required"))
+		})
+
+		It("rejects invalid udp payloads", func() {
+			expectInvalid(newTest("invalid-udp", edgeworksnov2.NetworktestSpec{
+				UDP: &edgeworksnov2.UDPProbe{Address: "10.0.0.1", Port: 514, Payload: "xyz", Encoding: edgeworksnov2.EncodingHex},
+			}), "invalid hex payload")
+		})
+
+		It("rejects invalid tcp steps", func() {
+			expectInvalid(newTest("invalid-tcp-steps", edgeworksnov2.NetworktestSpec{
+				TCP: &edgeworksnov2.TCPProbe{Address: "example.com", Port: 22, Steps: []edgeworksnov2.TCPStep{{Expect: "("}}},
+			}), "spec.tcp.steps[0].expect")
+		})
+
+		It("rejects tls settings on plaintext grpc probes", func() {
+			expectInvalid(newTest("invalid-grpc", edgeworksnov2.NetworktestSpec{
+				GRPC: &edgeworksnov2.GRPCProbe{Address: "example.com", Port: 50051, ServerName: "example.com"},
+			}), "spec.grpc.serverName")
+		})
+
+		It("rejects particular blocked outcomes for other probes than tcp", func() {
+			expectInvalid(newTest("invalid-outcome", edgeworksnov2.NetworktestSpec{
+				ExpectedOutcome: edgeworksnov2.OutcomeFiltered,
+				DNS:             &edgeworksnov2.DNSProbe{Name: "example.com"},
+			}), "only tcp probes can expect a particular blocked outcome")
+		})
+
+		It("rejects invalid cluster tests", func() {
+			expectInvalid(&edgeworksnov2.ClusterNetworktest{
+				ObjectMeta: metav1.ObjectMeta{Name: "invalid-cluster"},
+				Spec: edgeworksnov2.NetworktestSpec{
+					HTTP: &edgeworksnov2.HTTPProbe{URL: "https://example.com", ExpectCodes: []string{"abc"}},
+				},
+			}, "spec.http.expectCodes")
+		})
+
+		It("rejects tests outside the limits", func() {
+			expectInvalid(newTest("limits-interval", edgeworksnov2.NetworktestSpec{
+				Interval: &metav1.Duration{Duration: time.Millisecond},
+				DNS:      &edgeworksnov2.DNSProbe{Name: "example.com"},
+			}), "must be at least 1s")
+
+			expectInvalid(newTest("limits-timeout", edgeworksnov2.NetworktestSpec{
+				Timeout: &metav1.Duration{Duration: time.Hour},
+				DNS:     &edgeworksnov2.DNSProbe{Name: "example.com"},
+			}), "must be at most 1m0s")
+		})
+	})
+
+	Context("conversion webhook", func() {
+		It("serves v1 tests as v2", func() {
+			t := newV1Test("convert-v1", edgeworksnov1.NetworktestSpec{
+				Interval: "1m",
+				Timeout:  3,
+				TCP:      &edgeworksnov1.TCPProbe{Address: "example.com", Port: 443},
+			})
+			Expect(k8sClient.Create(ctx, t)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, t)
+
+			var converted edgeworksnov2.Networktest
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(t), &converted)).To(Succeed())
+			Expect(converted.Spec.Interval).To(Equal(&metav1.Duration{Duration: time.Minute}))
+			Expect(converted.Spec.Timeout).To(Equal(&metav1.Duration{Duration: 3 * time.Second}))
+			Expect(converted.Spec.TCP.Port).To(Equal(443))
+
+			// Durations are read back through v1 as written
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(t), t)).To(Succeed())
+			Expect(t.Spec.Interval).To(Equal("1m"))
+		})
+
+		It("keeps sub-second timeouts through v1", func() {
+			t := newTest("convert-v2", edgeworksnov2.NetworktestSpec{
+				Timeout: &metav1.Duration{Duration: 250 * time.Millisecond},
+				DNS:     &edgeworksnov2.DNSProbe{Name: "example.com"},
+			})
+			Expect(k8sClient.Create(ctx, t)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, t)
+
+			var old edgeworksnov1.Networktest
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(t), &old)).To(Succeed())
+			Expect(old.Spec.Timeout).To(Equal(1))
+			Expect(old.Annotations).To(HaveKeyWithValue(edgeworksnov1.TimeoutAnnotation, "250ms"))
+
+			old.Spec.Retries = 2
+			Expect(k8sClient.Update(ctx, &old)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(t), t)).To(Succeed())
+			Expect(t.Spec.Timeout).To(Equal(&metav1.Duration{Duration: 250 * time.Millisecond}))
+			Expect(t.Annotations).NotTo(HaveKey(edgeworksnov1.TimeoutAnnotation))
+		})
+
+		// The probe is kept in the conversion data annotation, so the v1 spec has none of the v1 probes
+		It("updates udp tests through v1", func() {
+			t := newTest("convert-udp", edgeworksnov2.NetworktestSpec{
+				UDP: &edgeworksnov2.UDPProbe{Address: "10.96.0.10", Port: 53},
+			})
+			Expect(k8sClient.Create(ctx, t)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, t)
+
+			var old edgeworksnov1.Networktest
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(t), &old)).To(Succeed())
+			Expect(old.Annotations).To(HaveKey(edgeworksnov1.ConversionDataAnnotation))
+
+			old.Spec.Retries = 2
+			Expect(k8sClient.Update(ctx, &old)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(t), t)).To(Succeed())
+			Expect(t.Spec.Retries).To(Equal(2))
+			Expect(t.Spec.UDP.Port).To(Equal(53))
+		})
+	})
+
+	// Schema validation runs before the validating webhook, so these are rejected by the CRD alone
+	Context("CRD validation rules", func() {
+		It("requires exactly one probe type", func() {
+			expectInvalid(newTest("cel-no-probe", edgeworksnov2.NetworktestSpec{}),
+				"exactly one of http, tcp, udp, icmp, grpc, dns or tls must be specified")
+
+			expectInvalid(newTest("cel-two-probes", edgeworksnov2.NetworktestSpec{
+				HTTP: &edgeworksnov2.HTTPProbe{URL: "https://example.com"},
+				TCP:  &edgeworksnov2.TCPProbe{Address: "example.com", Port: 443},
+			}), "exactly one of http, tcp, udp, icmp, grpc, dns or tls must be specified")
+		})
+
+		// Durations are written as strings in v1, so malformed ones can only be sent through v1
+		It("rejects malformed intervals", func() {
+			for _, interval := range []string{"5 minutes", "0s", "-1m"} {
+				expectInvalid(newV1Test("cel-interval", edgeworksnov1.NetworktestSpec{
+					Interval: interval,
+					DNS:      &edgeworksnov1.DNSProbe{Name: "example.com"},
+				}), "interval must be a duration greater than zero")
+			}
+
+			expectInvalid(newTest("cel-interval-v2", edgeworksnov2.NetworktestSpec{
+				Interval: &metav1.Duration{},
+				DNS:      &edgeworksnov2.DNSProbe{Name: "example.com"},
+			}), "interval must be a duration greater than zero")
+		})
+
+		It("rejects malformed retry delays", func() {
+			expectInvalid(newV1Test("cel-retry-delay", edgeworksnov1.NetworktestSpec{
+				RetryDelay: "soon",
+				DNS:        &edgeworksnov1.DNSProbe{Name: "example.com"},
+			}), "retryDelay must be a duration")
+		})
+
+		It("rejects urls that are not http or https", func() {
+			expectInvalid(newTest("cel-url", edgeworksnov2.NetworktestSpec{
+				HTTP: &edgeworksnov2.HTTPProbe{URL: "ftp://example.com"},
+			}), "url must be an http or https URL with a host")
+		})
+
+		It("rejects ports out of range", func() {
+			expectInvalid(newTest("cel-port", edgeworksnov2.NetworktestSpec{
+				TCP: &edgeworksnov2.TCPProbe{Address: "example.com", Port: 70000},
+			}), "spec.tcp.port")
+		})
+	})
+})
@@ -0,0 +1,207 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"edgeworks.no/networktester/pkg/scheduler"
+	"edgeworks.no/networktester/pkg/testers"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var testResult = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "networktester_probe",
+		Help: "Result of Networktester probe run",
+	}, []string{"namespace", "name", "address"})
+
+var certificateExpiry = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "networktester_certificate_expiry_timestamp_seconds",
+		Help: "Expiry time of the server certificate inspected by Networktester probe, in seconds since epoch",
+	}, []string{"namespace", "name", "address"})
+
+var probeRuns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "networktester_probe_runs_total",
+		Help: "Number of Networktester probe runs",
+	}, []string{"namespace", "name", "address"})
+
+var probeFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "networktester_probe_failures_total",
+		Help: "Number of failed Networktester probe runs, by reason",
+	}, []string{"namespace", "name", "address", "reason"})
+
+var probeDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "networktester_probe_duration_seconds",
+		Help:    "Duration of Networktester probe runs",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"namespace", "name", "address"})
+
+var probePhaseDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "networktester_probe_phase_duration_seconds",
+		Help:    "Duration of each phase of Networktester probe runs: dns, connect, tls and first_byte",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"namespace", "name", "address", "phase"})
+
+var pingPacketLoss = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "networktester_ping_packet_loss_ratio",
+		Help: "Ratio of echo requests without reply in the last run of Networktester ICMP probe",
+	}, []string{"namespace", "name", "address"})
+
+var pingRTT = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "networktester_ping_rtt_seconds",
+		Help: "Round trip times in the last run of Networktester ICMP probe: min, avg and max",
+	}, []string{"namespace", "name", "address", "stat"})
+
+var pingJitter = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "networktester_ping_jitter_seconds",
+		Help: "Mean difference between consecutive round trip times in the last run of Networktester ICMP probe",
+	}, []string{"namespace", "name", "address"})
+
+var queueWait = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "networktester_queue_wait_seconds",
+		Help:    "Time Networktester probes waited for a worker after being due",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+	})
+
+func init() {
+	metrics.Registry.Register(testResult)
+	metrics.Registry.Register(certificateExpiry)
+	metrics.Registry.Register(probeRuns)
+	metrics.Registry.Register(probeFailures)
+	metrics.Registry.Register(probeDuration)
+	metrics.Registry.Register(probePhaseDuration)
+	metrics.Registry.Register(pingPacketLoss)
+	metrics.Registry.Register(pingRTT)
+	metrics.Registry.Register(pingJitter)
+	metrics.Registry.Register(queueWait)
+}
+
+// perTestMetrics are the metrics with series labeled by namespace, name and address of a Networktest
+var perTestMetrics = []interface {
+	DeletePartialMatch(labels prometheus.Labels) int
+}{
+	testResult,
+	certificateExpiry,
+	probeRuns,
+	probeFailures,
+	probeDuration,
+	probePhaseDuration,
+	pingPacketLoss,
+	pingRTT,
+	pingJitter,
+}
+
+func newQueueDepth(s *scheduler.Scheduler) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "networktester_queue_depth",
+			Help: "Number of Networktester probes that are due and waiting for a worker",
+		}, func() float64 {
+			return float64(s.Waiting())
+		})
+}
+
+// deleteSeries removes all metric series of a Networktest
+func (r *NetworktestReconciler) deleteSeries(name types.NamespacedName) {
+	r.addresses.Delete(name)
+	for _, m := range perTestMetrics {
+		m.DeletePartialMatch(prometheus.Labels{"namespace": name.Namespace, "name": name.Name})
+	}
+}
+
+// updateSeriesAddress removes metric series of a Networktest with a previous address
+func (r *NetworktestReconciler) updateSeriesAddress(name types.NamespacedName, address string) {
+	previous, found := r.addresses.Swap(name, address)
+	if !found || previous.(string) == address {
+		return
+	}
+
+	for _, m := range perTestMetrics {
+		m.DeletePartialMatch(prometheus.Labels{"namespace": name.Namespace, "name": name.Name, "address": previous.(string)})
+	}
+}
+
+// countRun records a probe run, and the reason if it failed
+func countRun(name types.NamespacedName, address string, result testers.TestResult) {
+	probeRuns.WithLabelValues(name.Namespace, name.Name, address).Inc()
+	if !result.Success {
+		probeFailures.WithLabelValues(name.Namespace, name.Name, address, string(result.Reason)).Inc()
+	}
+}
+
+// observeTimings records the duration of a probe run and each of its phases. Phases not part of the probe are skipped.
+func observeTimings(name types.NamespacedName, address string, timings testers.Timings) {
+	if timings.Total == 0 {
+		return
+	}
+	probeDuration.WithLabelValues(name.Namespace, name.Name, address).Observe(timings.Total.Seconds())
+
+	phases := map[string]time.Duration{
+		"dns":        timings.DNSLookup,
+		"connect":    timings.Connect,
+		"tls":        timings.TLSHandshake,
+		"first_byte": timings.FirstByte,
+	}
+	for phase, d := range phases {
+		if d > 0 {
+			probePhaseDuration.WithLabelValues(name.Namespace, name.Name, address, phase).Observe(d.Seconds())
+		}
+	}
+}
+
+// observeCertificateExpiry records when the certificate inspected by a probe run expires. The previous value is kept
+// when the run did not get a certificate.
+func observeCertificateExpiry(name types.NamespacedName, address string, expiry *time.Time) {
+	if expiry == nil {
+		return
+	}
+	certificateExpiry.WithLabelValues(name.Namespace, name.Name, address).Set(float64(expiry.Unix()))
+}
+
+// observePing records the packet loss and round trip times of an ICMP probe run. Round trip times are left at their
+// previous values when no reply was received.
+func observePing(name types.NamespacedName, address string, stats *testers.PingStats) {
+	if stats == nil || stats.Sent == 0 {
+		return
+	}
+	pingPacketLoss.WithLabelValues(name.Namespace, name.Name, address).Set(stats.PacketLoss() / 100)
+	if stats.Received == 0 {
+		return
+	}
+
+	rtts := map[string]time.Duration{
+		"min": stats.MinRTT,
+		"avg": stats.AvgRTT,
+		"max": stats.MaxRTT,
+	}
+	for stat, d := range rtts {
+		pingRTT.WithLabelValues(name.Namespace, name.Name, address, stat).Set(d.Seconds())
+	}
+	pingJitter.WithLabelValues(name.Namespace, name.Name, address).Set(stats.Jitter.Seconds())
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDeleteSeries(t *testing.T) {
+	r := &NetworktestReconciler{}
+	removed := types.NamespacedName{Namespace: "metrics", Name: "removed"}
+	kept := types.NamespacedName{Namespace: "metrics", Name: "kept"}
+	for _, name := range []types.NamespacedName{removed, kept} {
+		r.updateSeriesAddress(name, "tcp://db:5432")
+		testResult.WithLabelValues(name.Namespace, name.Name, "tcp://db:5432").Set(1)
+		certificateExpiry.WithLabelValues(name.Namespace, name.Name, "tcp://db:5432").Set(1.7e9)
+	}
+	t.Cleanup(func() { r.deleteSeries(kept) })
+
+	results, expiries := testutil.CollectAndCount(testResult), testutil.CollectAndCount(certificateExpiry)
+	r.deleteSeries(removed)
+
+	if got := testutil.CollectAndCount(testResult); got != results-1 {
+		t.Errorf("deleteSeries() left %d result series, want %d", got, results-1)
+	}
+	if got := testutil.CollectAndCount(certificateExpiry); got != expiries-1 {
+		t.Errorf("deleteSeries() left %d certificate expiry series, want %d", got, expiries-1)
+	}
+	if got := testutil.ToFloat64(testResult.WithLabelValues(kept.Namespace, kept.Name, "tcp://db:5432")); got != 1 {
+		t.Errorf("deleteSeries() changed the series of another test")
+	}
+	if _, found := r.addresses.Load(removed); found {
+		t.Errorf("deleteSeries() kept the address of the test")
+	}
+}
+
+func TestUpdateSeriesAddress(t *testing.T) {
+	r := &NetworktestReconciler{}
+	name := types.NamespacedName{Namespace: "metrics", Name: "moved"}
+	t.Cleanup(func() { r.deleteSeries(name) })
+
+	r.updateSeriesAddress(name, "tcp://db:5432")
+	testResult.WithLabelValues(name.Namespace, name.Name, "tcp://db:5432").Set(1)
+	series := testutil.CollectAndCount(testResult)
+
+	// Series of the same address are kept
+	r.updateSeriesAddress(name, "tcp://db:5432")
+	if got := testutil.CollectAndCount(testResult); got != series {
+		t.Fatalf("updateSeriesAddress() with the same address left %d series, want %d", got, series)
+	}
+
+	r.updateSeriesAddress(name, "tcp://replica:5432")
+	testResult.WithLabelValues(name.Namespace, name.Name, "tcp://replica:5432").Set(0)
+	if got := testutil.CollectAndCount(testResult); got != series {
+		t.Errorf("updateSeriesAddress() with a new address left %d series, want %d", got, series)
+	}
+	if got := testutil.ToFloat64(testResult.WithLabelValues(name.Namespace, name.Name, "tcp://replica:5432")); got != 0 {
+		t.Errorf("series of the new address is %v, want 0", got)
+	}
+}
+
+func TestObserveCertificateExpiry(t *testing.T) {
+	name := types.NamespacedName{Namespace: "metrics", Name: "certificate"}
+	r := &NetworktestReconciler{}
+	r.updateSeriesAddress(name, "tls://example.com:443")
+	t.Cleanup(func() { r.deleteSeries(name) })
+
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	observeCertificateExpiry(name, "tls://example.com:443", &expiry)
+	gauge := certificateExpiry.WithLabelValues(name.Namespace, name.Name, "tls://example.com:443")
+	if got := testutil.ToFloat64(gauge); got != float64(expiry.Unix()) {
+		t.Errorf("certificate expiry = %v, want %v", got, float64(expiry.Unix()))
+	}
+
+	// A run failing before the certificate was received keeps the last known expiry
+	observeCertificateExpiry(name, "tls://example.com:443", nil)
+	if got := testutil.ToFloat64(gauge); got != float64(expiry.Unix()) {
+		t.Errorf("certificate expiry = %v after a run without a certificate, want %v", got, float64(expiry.Unix()))
+	}
+}
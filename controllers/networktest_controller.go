@@ -18,59 +18,102 @@ package controllers
 
 import (
 	"context"
+	"edgeworks.no/networktester/pkg/scheduler"
 	"edgeworks.no/networktester/pkg/testers"
 	"fmt"
-	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
 	k8errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"math"
 	"net/url"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	edgeworksnov1 "edgeworks.no/networktester/api/v1"
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
 )
 
-var testResult = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "networktester_probe",
-		Help: "Result of Networktester probe run",
-	}, []string{"namespace", "name", "address"})
-
-func init() {
-	metrics.Registry.Register(testResult)
-}
-
-// NetworktestReconciler reconciles a Networktest object
+// NetworktestReconciler reconciles Networktest and ClusterNetworktest objects
 type NetworktestReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 
-	Tests       sync.Map
-	TriggerChan chan struct{}
+	// APIReader reads directly from the API server, for objects that should not be cached
+	APIReader client.Reader
+
+	// Recorder emits events on result transitions and rejected specs
+	Recorder record.EventRecorder
+
+	// Workers is the number of probes that can run at the same time
+	Workers int
+
+	// MaxConcurrentPerHost limits the number of probes running against the same host. 0 means no limit.
+	MaxConcurrentPerHost int
+
+	// Limits bounds the interval and timeout of tests
+	Limits testers.Limits
+
+	// ClusterResourceNamespace is the namespace Secrets and ConfigMaps referenced by ClusterNetworktests are read from
+	ClusterResourceNamespace string
+
+	// references caches data of Secrets and ConfigMaps referenced by tests
+	references referenceCache
+
+	// retries holds the runs waiting to be retried, by test
+	retries sync.Map
+
+	// addresses keeps the address label of the metric series for each Networktest
+	addresses sync.Map
+
+	scheduler *scheduler.Scheduler
 }
 
-type Probe struct {
-	NextRun    time.Time
-	Name       types.NamespacedName
-	Generation int64
+// errorRetryInterval is the time to wait before trying again when a Networktest could not be read, or has an invalid
+// interval
+const errorRetryInterval = 30 * time.Second
+
+// destinationHost returns the host probed by the test, for limiting concurrent probes against the same host
+func destinationHost(spec edgeworksnov2.NetworktestSpec) string {
+	u, err := url.Parse(spec.GetAddress())
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// newObject returns an empty Networktest for keys with a namespace, and an empty ClusterNetworktest otherwise. Both are
+// scheduled by the same scheduler, keyed by namespace and name.
+func newObject(key types.NamespacedName) edgeworksnov2.NetworktestObject {
+	if key.Namespace == "" {
+		return &edgeworksnov2.ClusterNetworktest{}
+	}
+	return &edgeworksnov2.Networktest{}
 }
 
-func calcNextRun(i string) time.Time {
-	now := time.Now()
-	interval, _ := time.ParseDuration(i)
-	return now.Add(interval)
+// calcNextRun returns the time of the next run. Intervals are validated before tests are activated, so a non-positive
+// interval is an error, and the test is tried again after errorRetryInterval.
+func calcNextRun(interval time.Duration) (time.Time, error) {
+	if interval <= 0 {
+		return time.Now().Add(errorRetryInterval), fmt.Errorf("interval must be greater than zero, got %s", interval)
+	}
+	return time.Now().Add(interval), nil
 }
 
 //+kubebuilder:rbac:groups=edgeworks.no,resources=networktests,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=edgeworks.no,resources=networktests/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=edgeworks.no,resources=networktests/finalizers,verbs=update
+//+kubebuilder:rbac:groups=edgeworks.no,resources=clusternetworktests,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=edgeworks.no,resources=clusternetworktests/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=edgeworks.no,resources=clusternetworktests/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -84,11 +127,14 @@ func calcNextRun(i string) time.Time {
 func (r *NetworktestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
-	var test edgeworksnov1.Networktest
-	if err := r.Get(ctx, req.NamespacedName, &test); err != nil {
+	test := newObject(req.NamespacedName)
+	if err := r.Get(ctx, req.NamespacedName, test); err != nil {
 		if k8errors.IsNotFound(err) {
 			ctrl.Log.V(1).Info(fmt.Sprintf("Removed %s", req.NamespacedName.String()))
-			r.Tests.Delete(req.NamespacedName.String())
+			r.scheduler.Remove(req.NamespacedName)
+			r.deleteSeries(req.NamespacedName)
+			r.references.release(req.NamespacedName)
+			r.retries.Delete(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 
@@ -97,157 +143,320 @@ func (r *NetworktestReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	if !test.Status.Active && test.Spec.Enabled {
+	spec, status := test.GetSpec(), test.GetStatus()
+	if migrateConditions(status) {
+		ctrl.Log.Info("Migrated result history from conditions", "namespace", test.GetNamespace(), "name", test.GetName())
+	}
+
+	limitErrs := r.Limits.Check(*spec)
+	outsideLimits := r.Limits.Reject && len(limitErrs) > 0
+
+	if !status.Active && spec.GetEnabled() {
 		accepted := true
 		var message string
+		reason := edgeworksnov2.ReasonInvalidSpec
+
+		// Verify and set status. The same validation is done by the admission webhook, when it is enabled.
+		if errs := testers.ValidateSpec(*spec); len(errs) > 0 {
+			message = errs.ToAggregate().Error()
+			accepted = false
+		} else if outsideLimits {
+			message = limitErrs.ToAggregate().Error()
+			reason = edgeworksnov2.ReasonOutsideLimits
+			accepted = false
+		}
 
-		// Verify and set status
-		if test.Spec.Http != nil && test.Spec.Http.URL != "" {
-			if _, err := url.Parse(test.Spec.Http.URL); err != nil {
-				message = fmt.Errorf("Failed to parse URL: %v", err).Error()
-				accepted = false
-			}
-
-		} else if test.Spec.TCP != nil && test.Spec.TCP.Address != "" {
-			if test.Spec.TCP.Port <= 0 {
-				message = fmt.Errorf("invalid port: %d", test.Spec.TCP.Port).Error()
-				accepted = false
-			}
+		// Only report a rejection once, not on every reconcile of the same spec
+		if !accepted && status.Message != message {
+			r.Recorder.Event(test, corev1.EventTypeWarning, reason, message)
 		}
 
-		test.Status.Active = accepted
-		test.Status.Message = &message
-	} else if !test.Spec.Enabled && test.Status.Active {
-		test.Status.Conditions = []metav1.Condition{}
-		test.Status.Active = false
-		test.Status.NextRun = nil
-		test.Status.LastRun = nil
-		test.Status.LastResult = nil
-		disabled := "Disabled"
-		test.Status.Message = &disabled
+		if accepted {
+			setReady(status, test.GetGeneration(), metav1.ConditionUnknown, edgeworksnov2.ReasonPending, "Waiting for first run")
+		} else {
+			setReady(status, test.GetGeneration(), metav1.ConditionFalse, reason, message)
+		}
+		status.Active = accepted
+		status.Message = message
+	} else if spec.GetEnabled() && outsideLimits {
+		// Active test changed to be outside the limits
+		message := limitErrs.ToAggregate().Error()
+		r.Recorder.Event(test, corev1.EventTypeWarning, edgeworksnov2.ReasonOutsideLimits, message)
+		setReady(status, test.GetGeneration(), metav1.ConditionFalse, edgeworksnov2.ReasonOutsideLimits, message)
+		status.Active = false
+		status.NextRun = nil
+		status.Message = message
+	} else if !spec.GetEnabled() && status.Active {
+		setReady(status, test.GetGeneration(), metav1.ConditionFalse, edgeworksnov2.ReasonDisabled, "Disabled")
+		status.History = nil
+		status.Active = false
+		status.NextRun = nil
+		status.LastRun = nil
+		status.LastResult = ""
+		status.ConsecutiveSuccesses = 0
+		status.ConsecutiveFailures = 0
+		status.LastTimings = nil
+		status.Ping = nil
+		status.FailureReason = ""
+		status.ConnectionOutcome = ""
+		status.Message = "Disabled"
 	}
 
-	if err := r.Status().Update(ctx, &test); err != nil {
+	setClamped(status, test.GetGeneration(), r.Limits, limitErrs)
+
+	if err := r.Status().Update(ctx, test); err != nil {
 		ctrl.Log.Error(err, "Failed to update status of Networktest")
 		return ctrl.Result{}, err
 	}
 
-	if test.Status.Active {
+	if status.Active {
 		// Either add or replace probe
-		if probe, found := r.Tests.Load(req.NamespacedName.String()); !found {
-			probe := Probe{
-				Name:       req.NamespacedName,
-				Generation: test.Generation,
-				NextRun:    time.Now(),
-			}
-
-			r.Tests.Store(req.NamespacedName.String(), &probe)
+		added, updated := r.scheduler.Schedule(req.NamespacedName, test.GetGeneration(), destinationHost(*spec))
+		r.updateSeriesAddress(req.NamespacedName, spec.GetAddress())
+		if added {
 			ctrl.Log.V(1).Info(fmt.Sprintf("Added %s", req.NamespacedName.String()))
-			r.TriggerChan <- struct{}{}
-		} else {
-			p := probe.(*Probe)
-			if p.Generation != test.Generation {
-				p.NextRun = time.Now()
-				p.Generation = test.Generation
-				r.Tests.Swap(req.NamespacedName.String(), p)
-				ctrl.Log.V(1).Info(fmt.Sprintf("Updated %s", req.NamespacedName.String()))
-				r.TriggerChan <- struct{}{}
-			}
+		} else if updated {
+			ctrl.Log.V(1).Info(fmt.Sprintf("Updated %s", req.NamespacedName.String()))
 		}
 	} else {
 		// Remove probe
-		r.Tests.Delete(req.NamespacedName.String())
+		r.scheduler.Remove(req.NamespacedName)
+		r.deleteSeries(req.NamespacedName)
+		r.references.release(req.NamespacedName)
+		r.retries.Delete(req.NamespacedName)
 		ctrl.Log.V(1).Info(fmt.Sprintf("Deactivated %s", req.NamespacedName.String()))
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func (r *NetworktestReconciler) tester() {
-	for {
-		now := time.Now()
-		r.Tests.Range(func(n, p any) bool {
-			probe := p.(*Probe)
-			if probe.NextRun.Before(now) {
-				go r.performTest(probe)
-			}
-			return true
-		})
-
-		select {
-		case <-r.TriggerChan:
-		case <-time.After(30 * time.Second):
-		}
-	}
-}
-
-func (r *NetworktestReconciler) performTest(p *Probe) {
+// performTest runs the test and updates the status, and returns the time of the next run
+func (r *NetworktestReconciler) performTest(name types.NamespacedName) time.Time {
 
 	// Get resource, so we update the same as we are testing
-	var t edgeworksnov1.Networktest
-	if err := r.Get(context.Background(), p.Name, &t); err != nil {
+	t := newObject(name)
+	if err := r.Get(context.Background(), name, t); err != nil {
 		ctrl.Log.Error(err, "failed to get Networktest")
-		return
+		return time.Now().Add(errorRetryInterval)
 	}
-	ctrl.Log.V(1).Info("Testing", "namespace", t.Namespace, "name", t.Name, "generation", t.ObjectMeta.Generation)
+	ctrl.Log.V(1).Info("Testing", "namespace", t.GetNamespace(), "name", t.GetName(), "generation", t.GetGeneration())
 
 	// Calculate next run time before doing t, to ensure we keep up with the interval start to start
-	p.NextRun = calcNextRun(t.Spec.Interval)
+	spec := t.GetSpec().DeepCopy()
+	r.Limits.Clamp(spec)
+	nextRun, err := calcNextRun(spec.GetInterval())
+	if err != nil {
+		ctrl.Log.Error(err, "invalid interval", "namespace", t.GetNamespace(), "name", t.GetName())
+	}
 	now := metav1.NewTime(time.Now())
-	currentResourceVersion := t.ResourceVersion
+	attempt := 1
+	if previous, found := r.retries.LoadAndDelete(name); found && previous.(retry).generation == t.GetGeneration() {
+		nextRun, now, attempt = previous.(retry).nextRun, previous.(retry).started, previous.(retry).attempt+1
+	}
+	currentResourceVersion := t.GetResourceVersion()
 
 	// Perform t
-	result, err := testers.PerformTest(&t)
+	result, err := r.runTest(t)
 	if err != nil {
-		ctrl.Log.Info("Unknown probe type", "namespace", t.Namespace, "name", t.Name)
-		return
+		ctrl.Log.Info("Unknown probe type", "namespace", t.GetNamespace(), "name", t.GetName())
+		return nextRun
 	}
 
-	// Update metrics
-	testResult.WithLabelValues(p.Name.Namespace, p.Name.Name, t.Spec.GetAddress()).Set(getCondValue(result))
-
 	// Get again in case updated in the mean time
-	if err := r.Get(context.Background(), p.Name, &t); err != nil {
+	if err := r.Get(context.Background(), name, t); err != nil {
+		if k8errors.IsNotFound(err) {
+			// Removed while running, after the references of the test may have been released
+			r.references.release(name)
+		}
 		ctrl.Log.Error(err, "failed to get Networktest")
-		return
+		return nextRun
+	}
+
+	if currentResourceVersion != t.GetResourceVersion() {
+		ctrl.Log.Info("Definition changed during testing. Skipping writing status.", "namespace", t.GetNamespace(), "name", t.GetName())
+	}
+
+	// Deactivated during testing, so neither status nor metrics should be written
+	status := t.GetStatus()
+	if !status.Active {
+		return nextRun
+	}
+
+	// Failed attempts are retried by scheduling the test again, rather than holding the worker while waiting. Retries
+	// that would not start before the next run are skipped.
+	attempts := spec.Retries + 1
+	if retryAt := time.Now().Add(spec.GetRetryDelay()); !result.Success && attempt < attempts && retryAt.Before(nextRun) {
+		r.retries.Store(name, retry{generation: t.GetGeneration(), attempt: attempt, started: now, nextRun: nextRun})
+		return retryAt
+	}
+	if result.Success && attempt > 1 {
+		result.Message = fmt.Sprintf("%s (attempt %d/%d)", result.Message, attempt, attempts)
+	} else if !result.Success && attempt > 1 {
+		result.Message = fmt.Sprintf("%s (failed %d attempts)", result.Message, attempt)
+	}
+
+	// Update metrics. Runs are counted with their actual result, before thresholds are applied.
+	address := t.GetSpec().GetAddress()
+	r.updateSeriesAddress(name, address)
+	countRun(name, address, result)
+
+	result = applyThresholds(t, result)
+	r.recordTransition(t, result)
+
+	testResult.WithLabelValues(name.Namespace, name.Name, address).Set(getCondValue(result))
+	observeCertificateExpiry(name, address, result.CertificateExpiry)
+	observeTimings(name, address, result.Timings)
+	observePing(name, address, result.Ping)
+
+	status.LastResult = *result.String()
+	status.Message = result.Message
+	status.LastRun = &now
+	status.LastTimings = probeTimings(result.Timings)
+	status.Ping = pingStatistics(result.Ping)
+	status.FailureReason = string(result.Reason)
+	status.ConnectionOutcome = result.Outcome
+
+	next := metav1.NewTime(nextRun)
+	status.NextRun = &next
+
+	setReadyFromResult(t, result)
+	appendHistory(t, result, now)
+
+	if err := r.Status().Update(context.Background(), t); err != nil {
+		ctrl.Log.Info("Could not update status: "+err.Error(), "namespace", t.GetNamespace(), "name", t.GetName())
 	}
 
-	if currentResourceVersion != t.ResourceVersion {
-		ctrl.Log.Info("Definition changed during testing. Skipping writing status.", "namespace", t.Namespace, "name", t.Name)
+	return nextRun
+}
+
+// retry is a run of a test with a failed attempt, waiting to be retried
+type retry struct {
+	// generation of the test when the run started. Retries of an older generation are dropped.
+	generation int64
+
+	// attempt is the number of attempts made
+	attempt int
+
+	// started is the time the first attempt started
+	started metav1.Time
+
+	// nextRun is the time of the next run, calculated when the run started
+	nextRun time.Time
+}
+
+// runTest resolves references and performs an attempt of the test
+func (r *NetworktestReconciler) runTest(t edgeworksnov2.NetworktestObject) (testers.TestResult, error) {
+	resolved, tlsMaterial, err := r.resolveReferences(context.Background(), t)
+	if err != nil {
+		return testers.TestResult{
+			Success: false,
+			Reason:  testers.FailureConfig,
+			Message: fmt.Errorf("failed to resolve references: %v", err).Error(),
+		}, nil
 	}
+	r.Limits.Clamp(resolved)
 
-	t.Status.LastResult = result.String()
-	t.Status.Message = &result.Message
-	t.Status.LastRun = &now
+	return testers.PerformTest(resolved, tlsMaterial)
+}
+
+// applyThresholds counts consecutive successes and failures in the status, and keeps the previous result
+// until the success or failure threshold is reached
+func applyThresholds(t edgeworksnov2.NetworktestObject, result testers.TestResult) testers.TestResult {
+	spec, status := t.GetSpec(), t.GetStatus()
+	if result.Success {
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+	} else {
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+	}
+
+	// First result is used as is
+	if status.LastResult == "" {
+		return result
+	}
 
-	next := metav1.NewTime(p.NextRun)
-	t.Status.NextRun = &next
+	previous := status.LastResult == testers.Success
+	if previous == result.Success {
+		return result
+	}
 
-	cond := metav1.Condition{
-		Type:               "Probe",
-		Reason:             "Probe",
-		Status:             getCondStatus(result),
-		ObservedGeneration: t.ObjectMeta.Generation,
-		LastTransitionTime: now,
-		Message:            *t.Status.Message,
+	if result.Success && status.ConsecutiveSuccesses >= spec.GetSuccessThreshold() {
+		return result
+	}
+	if !result.Success && status.ConsecutiveFailures >= spec.GetFailureThreshold() {
+		return result
 	}
 
-	if len(t.Status.Conditions) == 0 {
-		t.Status.Conditions = append(t.Status.Conditions, cond)
+	held := result
+	held.Success = previous
+	held.Reason = ""
+	if !previous {
+		held.Reason = testers.FailureReason(status.FailureReason)
+	}
+	if result.Success {
+		held.Message = fmt.Sprintf("%s (%d/%d successes before changing to %s)", result.Message, status.ConsecutiveSuccesses, spec.GetSuccessThreshold(), testers.Success)
 	} else {
-		if t.Status.Conditions[len(t.Status.Conditions)-1].Status != cond.Status || t.Status.Conditions[len(t.Status.Conditions)-1].ObservedGeneration != cond.ObservedGeneration {
-			t.Status.Conditions = append(t.Status.Conditions, cond)
-		}
+		held.Message = fmt.Sprintf("%s (%d/%d failures before changing to %s)", result.Message, status.ConsecutiveFailures, spec.GetFailureThreshold(), testers.Failed)
 	}
+	return held
+}
 
-	if t.Spec.HistoryLimit != 0 && len(t.Status.Conditions) > t.Spec.HistoryLimit {
-		t.Status.Conditions = t.Status.Conditions[len(t.Status.Conditions)-t.Spec.HistoryLimit:]
+// recordTransition emits an event when the result changes from the previous run
+func (r *NetworktestReconciler) recordTransition(t edgeworksnov2.NetworktestObject, result testers.TestResult) {
+	if status := t.GetStatus(); status.LastResult == "" || status.LastResult == *result.String() {
+		return
 	}
 
-	if err = r.Status().Update(context.Background(), &t); err != nil {
-		ctrl.Log.Info("Could not update status: "+err.Error(), "namespace", t.Namespace, "name", t.Name)
+	if result.Success {
+		r.Recorder.Eventf(t, corev1.EventTypeNormal, edgeworksnov2.ReasonSucceeded, "Probe of %s changed to %s: %s", t.GetSpec().GetAddress(), testers.Success, result.Message)
+	} else {
+		r.Recorder.Eventf(t, corev1.EventTypeWarning, edgeworksnov2.ReasonFailed, "Probe of %s changed to %s (%s): %s", t.GetSpec().GetAddress(), testers.Failed, result.Reason, result.Message)
+	}
+}
+
+// probeTimings converts the timings of a probe run to the status representation, leaving out phases not part of the probe
+func probeTimings(timings testers.Timings) *edgeworksnov2.ProbeTimings {
+	if timings.Total == 0 {
+		return nil
 	}
 
+	duration := func(d time.Duration) *metav1.Duration {
+		if d == 0 {
+			return nil
+		}
+		return &metav1.Duration{Duration: d.Round(time.Microsecond)}
+	}
+	return &edgeworksnov2.ProbeTimings{
+		Total:        duration(timings.Total),
+		DNSLookup:    duration(timings.DNSLookup),
+		Connect:      duration(timings.Connect),
+		TLSHandshake: duration(timings.TLSHandshake),
+		FirstByte:    duration(timings.FirstByte),
+	}
+}
+
+// pingStatistics converts the packet loss and round trip times of an ICMP probe run to the status representation
+func pingStatistics(stats *testers.PingStats) *edgeworksnov2.PingStatistics {
+	if stats == nil {
+		return nil
+	}
+
+	duration := func(d time.Duration) *metav1.Duration {
+		if stats.Received == 0 {
+			return nil
+		}
+		return &metav1.Duration{Duration: d.Round(time.Microsecond)}
+	}
+	return &edgeworksnov2.PingStatistics{
+		Sent:       stats.Sent,
+		Received:   stats.Received,
+		PacketLoss: int(math.Round(stats.PacketLoss())),
+		MinRTT:     duration(stats.MinRTT),
+		AvgRTT:     duration(stats.AvgRTT),
+		MaxRTT:     duration(stats.MaxRTT),
+		Jitter:     duration(stats.Jitter),
+	}
 }
 
 func getCondStatus(result testers.TestResult) metav1.ConditionStatus {
@@ -269,8 +478,32 @@ func getCondValue(result testers.TestResult) float64 {
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NetworktestReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	go r.tester()
+	r.scheduler = scheduler.New(r.performTest, scheduler.Options{
+		Workers:              r.Workers,
+		MaxConcurrentPerHost: r.MaxConcurrentPerHost,
+		ObserveWait: func(d time.Duration) {
+			queueWait.Observe(d.Seconds())
+		},
+	})
+	if err := mgr.Add(r.scheduler); err != nil {
+		return err
+	}
+
+	if err := metrics.Registry.Register(newQueueDepth(r.scheduler)); err != nil {
+		return err
+	}
+
+	err := ctrl.NewControllerManagedBy(mgr).
+		For(&edgeworksnov2.Networktest{}).
+		WatchesMetadata(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.invalidateReference(secretKind))).
+		WatchesMetadata(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.invalidateReference(configMapKind))).
+		Complete(r)
+	if err != nil {
+		return err
+	}
+
+	// ClusterNetworktests are reconciled the same way, and told apart by their empty namespace
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&edgeworksnov1.Networktest{}).
+		For(&edgeworksnov2.ClusterNetworktest{}).
 		Complete(r)
 }
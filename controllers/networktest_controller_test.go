@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"edgeworks.no/networktester/pkg/scheduler"
+	"edgeworks.no/networktester/pkg/testers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+// run applies the thresholds to a result like a probe run, and stores it as the last result
+func run(test *edgeworksnov2.Networktest, success bool) testers.TestResult {
+	result := testers.TestResult{Success: success, Message: "probe"}
+	if !success {
+		result.Reason = testers.FailureTimeout
+	}
+
+	result = applyThresholds(test, result)
+	test.Status.LastResult = *result.String()
+	test.Status.FailureReason = string(result.Reason)
+	return result
+}
+
+func TestApplyThresholds(t *testing.T) {
+	test := &edgeworksnov2.Networktest{}
+	test.Spec.FailureThreshold = 3
+	test.Spec.SuccessThreshold = 2
+
+	// The first result is used as is
+	if result := run(test, true); !result.Success || result.Message != "probe" {
+		t.Fatalf("first run = %+v, want success", result)
+	}
+
+	// Failures are held until the failure threshold is reached
+	for i := 1; i < 3; i++ {
+		result := run(test, false)
+		if !result.Success || result.Reason != "" {
+			t.Fatalf("failure %d = %+v, want the previous success", i, result)
+		}
+		if want := fmt.Sprintf("(%d/3 failures before changing to Failed)", i); !strings.HasSuffix(result.Message, want) {
+			t.Errorf("failure %d message = %q, want it to end with %q", i, result.Message, want)
+		}
+	}
+	if result := run(test, false); result.Success || result.Reason != testers.FailureTimeout || result.Message != "probe" {
+		t.Fatalf("failure 3 = %+v, want failed", result)
+	}
+	if test.Status.ConsecutiveFailures != 3 || test.Status.ConsecutiveSuccesses != 0 {
+		t.Errorf("consecutive failures %d and successes %d, want 3 and 0", test.Status.ConsecutiveFailures, test.Status.ConsecutiveSuccesses)
+	}
+
+	// A failure in between successes starts counting again, and the reason of the failed result is kept
+	if result := run(test, true); result.Success || result.Reason != testers.FailureTimeout || !strings.HasSuffix(result.Message, "(1/2 successes before changing to Success)") {
+		t.Fatalf("success 1 = %+v, want the previous failure", result)
+	}
+	if result := run(test, false); result.Success || result.Message != "probe" {
+		t.Fatalf("failure after success = %+v, want failed without counting", result)
+	}
+	if result := run(test, true); result.Success {
+		t.Fatalf("success 1 after failure = %+v, want the previous failure", result)
+	}
+	if result := run(test, true); !result.Success || result.Reason != "" || result.Message != "probe" {
+		t.Fatalf("success 2 = %+v, want success", result)
+	}
+	if test.Status.ConsecutiveSuccesses != 2 || test.Status.ConsecutiveFailures != 0 {
+		t.Errorf("consecutive successes %d and failures %d, want 2 and 0", test.Status.ConsecutiveSuccesses, test.Status.ConsecutiveFailures)
+	}
+}
+
+func TestApplyThresholdsDefaults(t *testing.T) {
+	test := &edgeworksnov2.Networktest{}
+
+	// Without thresholds every result is used as is
+	for i, success := range []bool{true, false, true, false} {
+		if result := run(test, success); result.Success != success {
+			t.Errorf("run %d = %+v, want success %v", i, result, success)
+		}
+	}
+}
+
+// newTestReconciler returns a reconciler reading and writing the objects through a fake client, recording events
+func newTestReconciler(objects ...client.Object) (*NetworktestReconciler, *record.FakeRecorder) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(edgeworksnov2.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&edgeworksnov2.Networktest{}, &edgeworksnov2.ClusterNetworktest{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &NetworktestReconciler{
+		Client:    c,
+		Scheme:    scheme,
+		APIReader: c,
+		Recorder:  recorder,
+	}
+	r.scheduler = scheduler.New(r.performTest, scheduler.Options{})
+	return r, recorder
+}
+
+// events returns the events recorded so far
+func events(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestRecordTransition(t *testing.T) {
+	r, recorder := newTestReconciler()
+	test := &edgeworksnov2.Networktest{}
+	test.Spec.TCP = &edgeworksnov2.TCPProbe{Address: "db.example.com", Port: 5432}
+
+	// No event for the first result, nor for the same result again
+	r.recordTransition(test, testers.TestResult{Success: true, Message: "connected"})
+	test.Status.LastResult = testers.Success
+	r.recordTransition(test, testers.TestResult{Success: true, Message: "connected"})
+	if got := events(recorder); len(got) != 0 {
+		t.Fatalf("recordTransition() without a transition recorded %q", got)
+	}
+
+	r.recordTransition(test, testers.TestResult{Success: false, Reason: testers.FailureRefused, Message: "connection refused"})
+	test.Status.LastResult = testers.Failed
+	r.recordTransition(test, testers.TestResult{Success: true, Message: "connected"})
+
+	want := []string{
+		"Warning ProbeFailed Probe of tcp://db.example.com:5432 changed to Failed (refused): connection refused",
+		"Normal ProbeSucceeded Probe of tcp://db.example.com:5432 changed to Success: connected",
+	}
+	if got := events(recorder); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("recordTransition() recorded %q, want %q", got, want)
+	}
+}
+
+func TestRejectedSpecEvent(t *testing.T) {
+	test := &edgeworksnov2.Networktest{}
+	test.Namespace, test.Name = "default", "rejected"
+	test.Spec.TCP = &edgeworksnov2.TCPProbe{Address: "db.example.com", Port: -1}
+	r, recorder := newTestReconciler(test)
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(test)}
+
+	// Reconciling the same rejected spec again does not repeat the event
+	for i := 0; i < 3; i++ {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := events(recorder)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "Warning InvalidSpec ") {
+		t.Fatalf("Reconcile() of a rejected spec recorded %q, want one InvalidSpec event", got)
+	}
+
+	// A spec rejected for another reason is reported again
+	if err := r.Get(ctx, req.NamespacedName, test); err != nil {
+		t.Fatal(err)
+	}
+	test.Spec.TCP.Port = 0
+	if err := r.Update(ctx, test); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if got := events(recorder); len(got) != 1 || !strings.HasPrefix(got[0], "Warning InvalidSpec ") {
+		t.Errorf("Reconcile() of a spec rejected for another reason recorded %q, want one InvalidSpec event", got)
+	}
+
+	if err := r.Get(ctx, req.NamespacedName, test); err != nil {
+		t.Fatal(err)
+	}
+	if test.Status.Active {
+		t.Errorf("Reconcile() activated a rejected spec")
+	}
+}
+
+// newRetriedTest returns an active test probing the port, retried twice a second apart
+func newRetriedTest(port int) *edgeworksnov2.Networktest {
+	test := &edgeworksnov2.Networktest{}
+	test.Namespace, test.Name = "default", "retried"
+	test.Spec.Interval = &metav1.Duration{Duration: time.Minute}
+	test.Spec.Timeout = &metav1.Duration{Duration: time.Second}
+	test.Spec.Retries = 2
+	test.Spec.RetryDelay = &metav1.Duration{Duration: time.Second}
+	test.Spec.TCP = &edgeworksnov2.TCPProbe{Address: "127.0.0.1", Port: port}
+	test.Status.Active = true
+	return test
+}
+
+// closedPort returns a loopback port nothing listens on
+func closedPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	return port
+}
+
+// expectRun checks that the run was scheduled after the delay, within a margin for the time the probe took
+func expectRun(t *testing.T, next time.Time, start time.Time, delay time.Duration) {
+	t.Helper()
+	if d := next.Sub(start); d < delay || d > delay+500*time.Millisecond {
+		t.Errorf("next run in %s, want %s", d, delay)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	test := newRetriedTest(closedPort(t))
+	r, _ := newTestReconciler(test)
+	name := client.ObjectKeyFromObject(test)
+
+	first := time.Now()
+	expectRun(t, r.performTest(name), first, time.Second)
+	start := time.Now()
+	expectRun(t, r.performTest(name), start, time.Second)
+
+	// Results of attempts are only written when the run is complete
+	if err := r.Get(context.Background(), name, test); err != nil {
+		t.Fatal(err)
+	}
+	if test.Status.LastResult != "" || test.Status.LastRun != nil {
+		t.Fatalf("status written before the last attempt: %+v", test.Status)
+	}
+
+	// The last attempt is not retried, and the next run keeps the interval from the start of the first attempt
+	expectRun(t, r.performTest(name), first, time.Minute)
+	if err := r.Get(context.Background(), name, test); err != nil {
+		t.Fatal(err)
+	}
+	if test.Status.LastResult != testers.Failed || !strings.HasSuffix(test.Status.Message, "(failed 3 attempts)") {
+		t.Errorf("status after the last attempt = %+v, want failed after 3 attempts", test.Status)
+	}
+	if test.Status.LastRun == nil || test.Status.LastRun.Sub(first) > 100*time.Millisecond {
+		t.Errorf("last run at %v, want the start of the first attempt %s", test.Status.LastRun, first)
+	}
+	if _, found := r.retries.Load(name); found {
+		t.Errorf("retry kept after the last attempt")
+	}
+
+	// The next run starts over with the first attempt
+	start = time.Now()
+	expectRun(t, r.performTest(name), start, time.Second)
+}
+
+func TestRetriesResetOnSuccess(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	test := newRetriedTest(port)
+	r, _ := newTestReconciler(test)
+	name := client.ObjectKeyFromObject(test)
+
+	first := time.Now()
+	expectRun(t, r.performTest(name), first, time.Second)
+
+	// The target comes up before the retry
+	listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Skipf("port taken before the retry: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	expectRun(t, r.performTest(name), first, time.Minute)
+	if err := r.Get(context.Background(), name, test); err != nil {
+		t.Fatal(err)
+	}
+	if test.Status.LastResult != testers.Success || !strings.HasSuffix(test.Status.Message, "(attempt 2/3)") {
+		t.Errorf("status after a successful retry = %+v, want success on attempt 2", test.Status)
+	}
+	if _, found := r.retries.Load(name); found {
+		t.Errorf("retry kept after a successful attempt")
+	}
+
+	// A failure after the success starts over with the first attempt
+	_ = listener.Close()
+	start := time.Now()
+	expectRun(t, r.performTest(name), start, time.Second)
+	if previous, found := r.retries.Load(name); !found || previous.(retry).attempt != 1 {
+		t.Errorf("retry after a successful run = %+v, want the first attempt", previous)
+	}
+}
+
+func TestRetryNotBeforeNextRun(t *testing.T) {
+	test := newRetriedTest(closedPort(t))
+	test.Spec.RetryDelay = &metav1.Duration{Duration: 2 * time.Minute}
+	r, _ := newTestReconciler(test)
+	name := client.ObjectKeyFromObject(test)
+
+	// Retries that would not start before the next run are skipped
+	start := time.Now()
+	expectRun(t, r.performTest(name), start, time.Minute)
+	if err := r.Get(context.Background(), name, test); err != nil {
+		t.Fatal(err)
+	}
+	if test.Status.LastResult != testers.Failed || strings.Contains(test.Status.Message, "attempts") {
+		t.Errorf("status = %+v, want failed on the only attempt", test.Status)
+	}
+}
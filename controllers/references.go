@@ -0,0 +1,384 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"edgeworks.no/networktester/pkg/testers"
+	"fmt"
+	"slices"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+const (
+	secretKind    = "Secret"
+	configMapKind = "ConfigMap"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
+
+// resolveReferences returns a copy of the spec of the test where values referenced from Secrets and ConfigMaps
+// are filled in, together with the certificates to use for TLS, so the testers do not need access to the cluster.
+func (r *NetworktestReconciler) resolveReferences(ctx context.Context, t edgeworksnov2.NetworktestObject) (*edgeworksnov2.NetworktestSpec, *testers.TLSMaterial, error) {
+	resolved := t.GetSpec().DeepCopy()
+	tlsMaterial := &testers.TLSMaterial{}
+	namespace := r.referenceNamespace(t)
+	r.references.use(client.ObjectKeyFromObject(t), referencedKeys(resolved, namespace))
+
+	if h := resolved.HTTP; h != nil {
+		if err := r.resolveHeaders(ctx, namespace, h.Headers, "header"); err != nil {
+			return nil, nil, err
+		}
+
+		if ref := h.RequestBodyFrom; ref != nil {
+			value, found, err := r.configMapValue(ctx, namespace, ref)
+			if err != nil {
+				return nil, nil, fmt.Errorf("request body: %v", err)
+			}
+			if found {
+				h.RequestBody = value
+			}
+			h.RequestBodyFrom = nil
+		}
+
+		var err error
+		if tlsMaterial, err = r.loadTLSMaterial(ctx, namespace, h.CABundle, h.ClientCertificateSecret); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if p := resolved.TLS; p != nil {
+		var err error
+		if tlsMaterial, err = r.loadTLSMaterial(ctx, namespace, p.CABundle, p.ClientCertificateSecret); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if p := resolved.GRPC; p != nil {
+		if err := r.resolveHeaders(ctx, namespace, p.Metadata, "metadata"); err != nil {
+			return nil, nil, err
+		}
+
+		var err error
+		if tlsMaterial, err = r.loadTLSMaterial(ctx, namespace, p.CABundle, p.ClientCertificateSecret); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return resolved, tlsMaterial, nil
+}
+
+// referencedKeys returns the cache keys of the Secrets and ConfigMaps referenced by the spec, the same as
+// resolveReferences reads
+func referencedKeys(spec *edgeworksnov2.NetworktestSpec, namespace string) []string {
+	var keys []string
+	headers := func(headers []edgeworksnov2.HTTPHeader) {
+		for _, h := range headers {
+			if h.ValueFrom != nil {
+				keys = append(keys, referenceKey(secretKind, namespace, h.ValueFrom.Name))
+			}
+		}
+	}
+	tlsMaterial := func(ca *edgeworksnov2.CABundleSource, clientCertificateSecret string) {
+		if ca != nil && ca.ConfigMapKeyRef != nil {
+			keys = append(keys, referenceKey(configMapKind, namespace, ca.ConfigMapKeyRef.Name))
+		}
+		if ca != nil && ca.SecretKeyRef != nil {
+			keys = append(keys, referenceKey(secretKind, namespace, ca.SecretKeyRef.Name))
+		}
+		if clientCertificateSecret != "" {
+			keys = append(keys, referenceKey(secretKind, namespace, clientCertificateSecret))
+		}
+	}
+
+	if h := spec.HTTP; h != nil {
+		headers(h.Headers)
+		if h.RequestBodyFrom != nil {
+			keys = append(keys, referenceKey(configMapKind, namespace, h.RequestBodyFrom.Name))
+		}
+		tlsMaterial(h.CABundle, h.ClientCertificateSecret)
+	}
+	if p := spec.TLS; p != nil {
+		tlsMaterial(p.CABundle, p.ClientCertificateSecret)
+	}
+	if p := spec.GRPC; p != nil {
+		headers(p.Metadata)
+		tlsMaterial(p.CABundle, p.ClientCertificateSecret)
+	}
+	return keys
+}
+
+// resolveHeaders fills in the values of headers read from Secrets, described as kind in errors
+func (r *NetworktestReconciler) resolveHeaders(ctx context.Context, namespace string, headers []edgeworksnov2.HTTPHeader, kind string) error {
+	for i := range headers {
+		ref := headers[i].ValueFrom
+		if ref == nil {
+			continue
+		}
+
+		value, found, err := r.secretValue(ctx, namespace, ref)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", kind, headers[i].Name, err)
+		}
+		if found {
+			headers[i].Value = value
+		}
+		headers[i].ValueFrom = nil
+	}
+	return nil
+}
+
+// referenceNamespace returns the namespace Secrets and ConfigMaps referenced by the test are read from. Cluster
+// tests have no namespace of their own, and read them from the namespace of the controller.
+func (r *NetworktestReconciler) referenceNamespace(t edgeworksnov2.NetworktestObject) string {
+	if t.GetNamespace() == "" {
+		return r.ClusterResourceNamespace
+	}
+	return t.GetNamespace()
+}
+
+// loadTLSMaterial reads the CA bundle and client certificate referenced by a probe
+func (r *NetworktestReconciler) loadTLSMaterial(ctx context.Context, namespace string, ca *edgeworksnov2.CABundleSource, clientCertificateSecret string) (*testers.TLSMaterial, error) {
+	tlsMaterial := &testers.TLSMaterial{}
+
+	if ca != nil {
+		var bundle string
+		var found bool
+		var err error
+
+		switch {
+		case ca.ConfigMapKeyRef != nil && ca.SecretKeyRef != nil:
+			return nil, fmt.Errorf("caBundle: only one of configMapKeyRef and secretKeyRef can be set")
+		case ca.ConfigMapKeyRef != nil:
+			bundle, found, err = r.configMapValue(ctx, namespace, ca.ConfigMapKeyRef)
+		case ca.SecretKeyRef != nil:
+			bundle, found, err = r.secretValue(ctx, namespace, ca.SecretKeyRef)
+		default:
+			return nil, fmt.Errorf("caBundle: one of configMapKeyRef and secretKeyRef must be set")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("caBundle: %v", err)
+		}
+
+		if found {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM([]byte(bundle)) {
+				return nil, fmt.Errorf("caBundle: no valid PEM encoded certificates found")
+			}
+			tlsMaterial.RootCAs = pool
+		}
+	}
+
+	if clientCertificateSecret != "" {
+		data, err := r.referencedData(ctx, secretKind, namespace, clientCertificateSecret)
+		if err != nil {
+			return nil, fmt.Errorf("clientCertificateSecret: %v", err)
+		}
+
+		cert, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("clientCertificateSecret: %v", err)
+		}
+		tlsMaterial.ClientCertificate = &cert
+	}
+
+	return tlsMaterial, nil
+}
+
+// secretValue reads the value of a Secret key. Missing optional Secrets or keys are reported as not found.
+func (r *NetworktestReconciler) secretValue(ctx context.Context, namespace string, ref *corev1.SecretKeySelector) (string, bool, error) {
+	return r.referencedValue(ctx, secretKind, namespace, ref.Name, ref.Key, ref.Optional != nil && *ref.Optional)
+}
+
+// configMapValue reads the value of a ConfigMap key. Missing optional ConfigMaps or keys are reported as not found.
+func (r *NetworktestReconciler) configMapValue(ctx context.Context, namespace string, ref *corev1.ConfigMapKeySelector) (string, bool, error) {
+	return r.referencedValue(ctx, configMapKind, namespace, ref.Name, ref.Key, ref.Optional != nil && *ref.Optional)
+}
+
+func (r *NetworktestReconciler) referencedValue(ctx context.Context, kind string, namespace string, name string, key string, optional bool) (string, bool, error) {
+	data, err := r.referencedData(ctx, kind, namespace, name)
+	if err != nil {
+		if k8errors.IsNotFound(err) && optional {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	value, ok := data[key]
+	if !ok {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("key %s not found in %s %s", key, kind, name)
+	}
+
+	return string(value), true, nil
+}
+
+// referencedData returns the data of a Secret or ConfigMap. The data is cached until the object changes. Objects are
+// read through the API reader, to avoid caching all Secrets and ConfigMaps in the cluster in the manager cache.
+func (r *NetworktestReconciler) referencedData(ctx context.Context, kind string, namespace string, name string) (map[string][]byte, error) {
+	key := referenceKey(kind, namespace, name)
+	data, found, generation := r.references.load(key)
+	if found {
+		return data, nil
+	}
+
+	if namespace == "" {
+		return nil, fmt.Errorf("no namespace to read %s %s from, the cluster resource namespace of the controller is not set", kind, name)
+	}
+
+	data = map[string][]byte{}
+	nn := types.NamespacedName{Namespace: namespace, Name: name}
+
+	switch kind {
+	case secretKind:
+		var secret corev1.Secret
+		if err := r.APIReader.Get(ctx, nn, &secret); err != nil {
+			return nil, err
+		}
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+	case configMapKind:
+		var cm corev1.ConfigMap
+		if err := r.APIReader.Get(ctx, nn, &cm); err != nil {
+			return nil, err
+		}
+		for k, v := range cm.BinaryData {
+			data[k] = v
+		}
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+
+	r.references.store(key, data, generation)
+	return data, nil
+}
+
+// invalidateReference returns a handler function removing changed Secrets or ConfigMaps from the cache
+func (r *NetworktestReconciler) invalidateReference(kind string) handler.MapFunc {
+	return func(_ context.Context, o client.Object) []reconcile.Request {
+		r.references.invalidate(referenceKey(kind, o.GetNamespace(), o.GetName()))
+		return nil
+	}
+}
+
+// referenceCache caches the data of Secrets and ConfigMaps referenced by tests, until the objects change or are no
+// longer referenced by any test. The zero value is an empty cache.
+type referenceCache struct {
+	mu   sync.Mutex
+	data map[string]map[string][]byte
+
+	// generation is increased by every invalidation. Data read before an invalidation may be stale, and is only stored
+	// when no invalidation happened while it was read.
+	generation uint64
+
+	// keys holds the references of each test, as of the last time its references were resolved, and refs the number
+	// of tests referencing each key
+	keys map[types.NamespacedName][]string
+	refs map[string]int
+}
+
+// load returns the cached data of the key, or the generation to store the data read for it with
+func (c *referenceCache) load(key string) (map[string][]byte, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, found := c.data[key]
+	return data, found, c.generation
+}
+
+// store caches the data of the key, unless it was invalidated since the generation was loaded
+func (c *referenceCache) store(key string, data map[string][]byte, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation || c.refs[key] == 0 {
+		return
+	}
+	if c.data == nil {
+		c.data = map[string]map[string][]byte{}
+	}
+	c.data[key] = data
+}
+
+func (c *referenceCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.data, key)
+}
+
+// use records the references of the test, and drops data no test references any more
+func (c *referenceCache) use(test types.NamespacedName, keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = map[types.NamespacedName][]string{}
+		c.refs = map[string]int{}
+	}
+
+	// A test can reference the same object more than once, but counts as one reference. The new references are
+	// counted before the old ones are dropped, so data the test still references is kept.
+	keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+	for _, key := range keys {
+		c.refs[key]++
+	}
+	c.drop(test)
+	if len(keys) > 0 {
+		c.keys[test] = keys
+	}
+}
+
+// release drops the references of a removed test
+func (c *referenceCache) release(test types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(test)
+}
+
+// drop removes the references of the test, and the data of keys no other test references
+func (c *referenceCache) drop(test types.NamespacedName) {
+	for _, key := range c.keys[test] {
+		c.refs[key]--
+		if c.refs[key] == 0 {
+			delete(c.refs, key)
+			delete(c.data, key)
+		}
+	}
+	delete(c.keys, test)
+}
+
+func referenceKey(kind string, namespace string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
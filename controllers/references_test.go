@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+// newReferencingTest returns a test with a header from the Secret and a request body from the ConfigMap
+func newReferencingTest(name string) *edgeworksnov2.Networktest {
+	test := &edgeworksnov2.Networktest{}
+	test.Namespace, test.Name = "default", name
+	test.Spec.HTTP = &edgeworksnov2.HTTPProbe{
+		URL: "https://api.example.com",
+		Headers: []edgeworksnov2.HTTPHeader{{
+			Name: "Authorization",
+			ValueFrom: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "api-token"},
+				Key:                  "token",
+			},
+		}},
+		RequestBodyFrom: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "api-request"},
+			Key:                  "body",
+		},
+	}
+	return test
+}
+
+func TestResolveReferences(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"token": []byte("Bearer one")}}
+	secret.Namespace, secret.Name = "default", "api-token"
+	configMap := &corev1.ConfigMap{Data: map[string]string{"body": `{"query": "status"}`}}
+	configMap.Namespace, configMap.Name = "default", "api-request"
+	r, _ := newTestReconciler(secret, configMap)
+	ctx := context.Background()
+	test := newReferencingTest("api")
+
+	resolve := func() *edgeworksnov2.HTTPProbe {
+		t.Helper()
+		spec, _, err := r.resolveReferences(ctx, test)
+		if err != nil {
+			t.Fatalf("resolveReferences() failed: %v", err)
+		}
+		return spec.HTTP
+	}
+
+	probe := resolve()
+	if probe.Headers[0].Value != "Bearer one" || probe.Headers[0].ValueFrom != nil {
+		t.Errorf("resolveReferences() header = %+v, want the value of the Secret", probe.Headers[0])
+	}
+	if probe.RequestBody != `{"query": "status"}` || probe.RequestBodyFrom != nil {
+		t.Errorf("resolveReferences() request body = %q, want the value of the ConfigMap", probe.RequestBody)
+	}
+	if test.Spec.HTTP.Headers[0].Value != "" {
+		t.Errorf("resolveReferences() changed the spec of the test")
+	}
+
+	// Changes are not read until the cached data is invalidated
+	secret.Data["token"] = []byte("Bearer two")
+	if err := r.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if probe := resolve(); probe.Headers[0].Value != "Bearer one" {
+		t.Errorf("resolveReferences() header = %q, want the cached value", probe.Headers[0].Value)
+	}
+	r.invalidateReference(secretKind)(ctx, secret)
+	if probe := resolve(); probe.Headers[0].Value != "Bearer two" {
+		t.Errorf("resolveReferences() header = %q after the Secret changed, want the new value", probe.Headers[0].Value)
+	}
+
+	configMap.Data["body"] = `{"query": "health"}`
+	if err := r.Update(ctx, configMap); err != nil {
+		t.Fatal(err)
+	}
+	r.invalidateReference(configMapKind)(ctx, configMap)
+	if probe := resolve(); probe.RequestBody != `{"query": "health"}` {
+		t.Errorf("resolveReferences() request body = %q after the ConfigMap changed, want the new value", probe.RequestBody)
+	}
+
+	// A missing Secret is an error, unless it is optional
+	if err := r.Delete(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	r.invalidateReference(secretKind)(ctx, secret)
+	if _, _, err := r.resolveReferences(ctx, test); err == nil {
+		t.Errorf("resolveReferences() of a missing Secret succeeded")
+	}
+	optional := true
+	test.Spec.HTTP.Headers[0].ValueFrom.Optional = &optional
+	if probe := resolve(); probe.Headers[0].Value != "" {
+		t.Errorf("resolveReferences() header = %q of a missing optional Secret, want no value", probe.Headers[0].Value)
+	}
+}
+
+func TestReferenceCacheEviction(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"token": []byte("Bearer one")}}
+	secret.Namespace, secret.Name = "default", "api-token"
+	configMap := &corev1.ConfigMap{Data: map[string]string{"body": "{}"}}
+	configMap.Namespace, configMap.Name = "default", "api-request"
+	r, _ := newTestReconciler(secret, configMap)
+	ctx := context.Background()
+	first, second := newReferencingTest("first"), newReferencingTest("second")
+	secretKey := referenceKey(secretKind, "default", "api-token")
+	configMapKey := referenceKey(configMapKind, "default", "api-request")
+
+	for _, test := range []*edgeworksnov2.Networktest{first, second} {
+		if _, _, err := r.resolveReferences(ctx, test); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.references.data) != 2 || r.references.refs[secretKey] != 2 {
+		t.Fatalf("cache holds %d objects, %d references to the Secret, want 2 objects referenced by both tests", len(r.references.data), r.references.refs[secretKey])
+	}
+
+	// Data is kept while another test references it
+	first.Spec.HTTP.RequestBodyFrom = nil
+	if _, _, err := r.resolveReferences(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	r.references.release(client.ObjectKeyFromObject(second))
+	if _, found, _ := r.references.load(configMapKey); found {
+		t.Errorf("the ConfigMap is still cached after no test references it")
+	}
+	if _, found, _ := r.references.load(secretKey); !found {
+		t.Errorf("the Secret was dropped while the first test references it")
+	}
+
+	r.references.release(client.ObjectKeyFromObject(first))
+	if len(r.references.data) != 0 || len(r.references.refs) != 0 || len(r.references.keys) != 0 {
+		t.Errorf("cache holds %v after all tests are released, want it empty", r.references.data)
+	}
+
+	// Data read for an object no test references any more is not stored
+	_, _, generation := r.references.load(secretKey)
+	r.references.store(secretKey, secret.Data, generation)
+	if _, found, _ := r.references.load(secretKey); found {
+		t.Errorf("store() cached an object no test references")
+	}
+}
+
+func TestReferenceCacheStaleData(t *testing.T) {
+	var cache referenceCache
+	test := types.NamespacedName{Namespace: "default", Name: "api"}
+	key := referenceKey(secretKind, "default", "api-token")
+
+	// A test referencing the same object twice holds one reference to it
+	cache.use(test, []string{key, key})
+	if cache.refs[key] != 1 {
+		t.Errorf("use() counted %d references, want 1", cache.refs[key])
+	}
+
+	// Data read while the object changed may be stale
+	_, _, generation := cache.load(key)
+	cache.invalidate(key)
+	cache.store(key, map[string][]byte{"token": []byte("stale")}, generation)
+	if _, found, _ := cache.load(key); found {
+		t.Errorf("store() cached data read before an invalidation")
+	}
+
+	_, _, generation = cache.load(key)
+	cache.store(key, map[string][]byte{"token": []byte("fresh")}, generation)
+	if data, found, _ := cache.load(key); !found || string(data["token"]) != "fresh" {
+		t.Errorf("load() = %q, %v, want the stored data", data["token"], found)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"edgeworks.no/networktester/pkg/testers"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+// legacyProbeCondition is the condition type previously appended to the conditions on every result transition
+const legacyProbeCondition = "Probe"
+
+// setReady sets the Ready condition. The transition time is only changed when the condition status changes.
+func setReady(status *edgeworksnov2.NetworktestStatus, generation int64, conditionStatus metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               edgeworksnov2.ConditionReady,
+		Status:             conditionStatus,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+}
+
+// setReadyFromResult sets the Ready condition from the result of a run
+func setReadyFromResult(t edgeworksnov2.NetworktestObject, result testers.TestResult) {
+	reason := edgeworksnov2.ReasonFailed
+	if result.Success {
+		reason = edgeworksnov2.ReasonSucceeded
+	}
+	setReady(t.GetStatus(), t.GetGeneration(), getCondStatus(result), reason, result.Message)
+}
+
+// appendHistory adds the result to the history when it differs from the previous result, or the spec has changed
+// since, and trims the history to the history limit
+func appendHistory(t edgeworksnov2.NetworktestObject, result testers.TestResult, now metav1.Time) {
+	spec, status := t.GetSpec(), t.GetStatus()
+	entry := edgeworksnov2.ResultHistoryEntry{
+		Time:               now,
+		Result:             *result.String(),
+		Message:            result.Message,
+		ObservedGeneration: t.GetGeneration(),
+	}
+	if result.Timings.Total > 0 {
+		entry.Latency = &metav1.Duration{Duration: result.Timings.Total.Round(time.Microsecond)}
+	}
+
+	history := status.History
+	if len(history) == 0 || history[len(history)-1].Result != entry.Result || history[len(history)-1].ObservedGeneration != entry.ObservedGeneration {
+		status.History = append(status.History, entry)
+	}
+
+	if spec.HistoryLimit != 0 && len(status.History) > spec.HistoryLimit {
+		status.History = status.History[len(status.History)-spec.HistoryLimit:]
+	}
+}
+
+// migrateConditions moves result transitions kept as Probe conditions by earlier versions to the history, and sets
+// the Ready condition from the last of them. Returns whether the status was changed.
+func migrateConditions(status *edgeworksnov2.NetworktestStatus) bool {
+	var legacy, conditions []metav1.Condition
+	for _, c := range status.Conditions {
+		if c.Type == legacyProbeCondition {
+			legacy = append(legacy, c)
+		} else {
+			conditions = append(conditions, c)
+		}
+	}
+	if len(legacy) == 0 {
+		return false
+	}
+
+	if len(status.History) == 0 {
+		for _, c := range legacy {
+			result := testers.Failed
+			if c.Status == metav1.ConditionTrue {
+				result = testers.Success
+			}
+			status.History = append(status.History, edgeworksnov2.ResultHistoryEntry{
+				Time:               c.LastTransitionTime,
+				Result:             result,
+				Message:            c.Message,
+				ObservedGeneration: c.ObservedGeneration,
+			})
+		}
+	}
+
+	status.Conditions = conditions
+	if meta.FindStatusCondition(status.Conditions, edgeworksnov2.ConditionReady) == nil {
+		last := legacy[len(legacy)-1]
+		reason := edgeworksnov2.ReasonFailed
+		if last.Status == metav1.ConditionTrue {
+			reason = edgeworksnov2.ReasonSucceeded
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               edgeworksnov2.ConditionReady,
+			Status:             last.Status,
+			Reason:             reason,
+			Message:            last.Message,
+			ObservedGeneration: last.ObservedGeneration,
+			LastTransitionTime: last.LastTransitionTime,
+		})
+	}
+
+	return true
+}
+
+// setClamped sets the Clamped condition when the interval or timeout is clamped to the limits of the controller, and
+// removes it otherwise
+func setClamped(status *edgeworksnov2.NetworktestStatus, generation int64, limits testers.Limits, limitErrs field.ErrorList) {
+	if limits.Reject || len(limitErrs) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, edgeworksnov2.ConditionClamped)
+		return
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               edgeworksnov2.ConditionClamped,
+		Status:             metav1.ConditionTrue,
+		Reason:             edgeworksnov2.ReasonOutsideLimits,
+		Message:            "Using the limits of the controller: " + limitErrs.ToAggregate().Error(),
+		ObservedGeneration: generation,
+	})
+}
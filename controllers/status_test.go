@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"edgeworks.no/networktester/pkg/testers"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+func TestMigrateConditions(t *testing.T) {
+	first := metav1.NewTime(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC))
+	second := metav1.NewTime(first.Add(time.Hour))
+	status := edgeworksnov2.NetworktestStatus{
+		Conditions: []metav1.Condition{
+			{Type: legacyProbeCondition, Status: metav1.ConditionTrue, Reason: "Success", Message: "http result: 200 OK", ObservedGeneration: 1, LastTransitionTime: first},
+			{Type: "Degraded", Status: metav1.ConditionFalse, Reason: "AsExpected", LastTransitionTime: first},
+			{Type: legacyProbeCondition, Status: metav1.ConditionFalse, Reason: "Failed", Message: "http result: 503 Service Unavailable", ObservedGeneration: 2, LastTransitionTime: second},
+		},
+	}
+
+	if !migrateConditions(&status) {
+		t.Fatal("migrateConditions() = false, want the status to be changed")
+	}
+
+	want := []edgeworksnov2.ResultHistoryEntry{
+		{Time: first, Result: testers.Success, Message: "http result: 200 OK", ObservedGeneration: 1},
+		{Time: second, Result: testers.Failed, Message: "http result: 503 Service Unavailable", ObservedGeneration: 2},
+	}
+	if fmt.Sprint(status.History) != fmt.Sprint(want) {
+		t.Errorf("migrateConditions() set history %+v, want %+v", status.History, want)
+	}
+
+	if meta.FindStatusCondition(status.Conditions, legacyProbeCondition) != nil {
+		t.Errorf("migrateConditions() kept the Probe conditions: %+v", status.Conditions)
+	}
+	if meta.FindStatusCondition(status.Conditions, "Degraded") == nil {
+		t.Errorf("migrateConditions() removed other conditions: %+v", status.Conditions)
+	}
+
+	// The Ready condition is set from the last transition, at the time of it
+	ready := meta.FindStatusCondition(status.Conditions, edgeworksnov2.ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != edgeworksnov2.ReasonFailed || !ready.LastTransitionTime.Equal(&second) || ready.ObservedGeneration != 2 {
+		t.Errorf("migrateConditions() set Ready condition %+v, want it from the last Probe condition", ready)
+	}
+
+	if migrateConditions(&status) {
+		t.Errorf("migrateConditions() of a migrated status = true, want no change")
+	}
+}
+
+func TestMigrateConditionsKeepsHistory(t *testing.T) {
+	now := metav1.Now()
+	history := []edgeworksnov2.ResultHistoryEntry{{Time: now, Result: testers.Success, ObservedGeneration: 3}}
+	status := edgeworksnov2.NetworktestStatus{
+		Conditions: []metav1.Condition{
+			{Type: edgeworksnov2.ConditionReady, Status: metav1.ConditionTrue, Reason: edgeworksnov2.ReasonSucceeded, LastTransitionTime: now},
+			{Type: legacyProbeCondition, Status: metav1.ConditionFalse, Reason: "Failed", LastTransitionTime: now},
+		},
+		History: history,
+	}
+
+	if !migrateConditions(&status) {
+		t.Fatal("migrateConditions() = false, want the Probe condition to be removed")
+	}
+	if len(status.History) != 1 || status.History[0].ObservedGeneration != 3 {
+		t.Errorf("migrateConditions() replaced the existing history: %+v", status.History)
+	}
+	if ready := meta.FindStatusCondition(status.Conditions, edgeworksnov2.ConditionReady); ready == nil || ready.Status != metav1.ConditionTrue {
+		t.Errorf("migrateConditions() replaced the existing Ready condition: %+v", ready)
+	}
+}
+
+func TestAppendHistory(t *testing.T) {
+	test := &edgeworksnov2.Networktest{}
+	test.Generation = 1
+	test.Spec.HistoryLimit = 3
+	start := time.Now()
+
+	results := []bool{true, true, false, true, false, false}
+	for i, success := range results {
+		appendHistory(test, testers.TestResult{Success: success}, metav1.NewTime(start.Add(time.Duration(i)*time.Minute)))
+	}
+
+	// Repeated results are not added, and the oldest entries are trimmed to the limit
+	history := test.Status.History
+	if len(history) != 3 {
+		t.Fatalf("appendHistory() kept %d entries, want 3: %+v", len(history), history)
+	}
+	for i, want := range []string{testers.Failed, testers.Success, testers.Failed} {
+		if history[i].Result != want {
+			t.Errorf("history[%d] is %s, want %s", i, history[i].Result, want)
+		}
+	}
+	if !history[2].Time.Time.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("history[2] is from %s, want the time of the first of the repeated failures", history[2].Time)
+	}
+
+	// A changed spec is recorded even when the result is the same
+	test.Generation = 2
+	appendHistory(test, testers.TestResult{Success: false, Timings: testers.Timings{Total: 1500 * time.Microsecond}}, metav1.Now())
+	last := test.Status.History[len(test.Status.History)-1]
+	if len(test.Status.History) != 3 || last.ObservedGeneration != 2 || last.Latency == nil || last.Latency.Duration != 1500*time.Microsecond {
+		t.Errorf("appendHistory() after a spec change = %+v, want an entry for generation 2 with its latency", test.Status.History)
+	}
+}
+
+func TestAppendHistoryWithoutLimit(t *testing.T) {
+	test := &edgeworksnov2.Networktest{}
+	for i := 0; i < 50; i++ {
+		appendHistory(test, testers.TestResult{Success: i%2 == 0}, metav1.Now())
+	}
+	if len(test.Status.History) != 50 {
+		t.Errorf("appendHistory() without a limit kept %d entries, want 50", len(test.Status.History))
+	}
+}
+
+func TestSetReady(t *testing.T) {
+	status := &edgeworksnov2.NetworktestStatus{}
+	setReady(status, 1, metav1.ConditionTrue, edgeworksnov2.ReasonSucceeded, "http result: 200 OK")
+
+	// Backdate the transition, to tell it apart from the updates below
+	transition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	status.Conditions[0].LastTransitionTime = transition
+
+	setReady(status, 2, metav1.ConditionTrue, edgeworksnov2.ReasonSucceeded, "http result: 204 No Content")
+	ready := meta.FindStatusCondition(status.Conditions, edgeworksnov2.ConditionReady)
+	if !ready.LastTransitionTime.Equal(&transition) {
+		t.Errorf("setReady() with the same status changed the transition time to %s", ready.LastTransitionTime)
+	}
+	if ready.Message != "http result: 204 No Content" || ready.ObservedGeneration != 2 {
+		t.Errorf("setReady() did not update the message and generation: %+v", ready)
+	}
+
+	setReady(status, 2, metav1.ConditionFalse, edgeworksnov2.ReasonFailed, "http result: 503 Service Unavailable")
+	ready = meta.FindStatusCondition(status.Conditions, edgeworksnov2.ConditionReady)
+	if ready.LastTransitionTime.Equal(&transition) || ready.Status != metav1.ConditionFalse {
+		t.Errorf("setReady() with a changed status kept the transition time: %+v", ready)
+	}
+	if len(status.Conditions) != 1 {
+		t.Errorf("setReady() added conditions: %+v", status.Conditions)
+	}
+}
@@ -63,3 +63,7 @@ data:
     host: "localhost:${reg_port}"
     help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
 EOF
+
+# 6. Install cert-manager, issuing the certificate of the webhooks
+kubectl apply -f https://github.com/cert-manager/cert-manager/releases/download/v1.14.4/cert-manager.yaml
+kubectl wait --for=condition=Available --timeout=300s -n cert-manager deployment --all
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"os"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -34,7 +35,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	edgeworksnov1 "edgeworks.no/networktester/api/v1"
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
 	"edgeworks.no/networktester/controllers"
+	"edgeworks.no/networktester/pkg/testers"
+	"edgeworks.no/networktester/webhooks"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -47,6 +51,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(edgeworksnov1.AddToScheme(scheme))
+	utilruntime.Must(edgeworksnov2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -55,12 +60,30 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var restrictNamespace string
+	var clusterResourceNamespace string
+	var workers int
+	var maxConcurrentPerHost int
+	var enableWebhooks bool
+	var limits testers.Limits
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	flag.StringVar(&restrictNamespace, "restrict-namespace", "", "Restrict to watching single namespace")
+	flag.StringVar(&restrictNamespace, "restrict-namespace", "", "Restrict to watching single namespace. ClusterNetworktests are watched regardless.")
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "",
+		"Namespace Secrets and ConfigMaps referenced by ClusterNetworktests are read from. Usually the namespace of the controller.")
+	flag.IntVar(&workers, "workers", 10, "Number of probes that can run at the same time")
+	flag.IntVar(&maxConcurrentPerHost, "max-concurrent-per-host", 0,
+		"Max number of probes running against the same host at the same time. 0 means no limit.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the admission and conversion webhooks. Requires a serving certificate in /tmp/k8s-webhook-server/serving-certs.")
+	flag.DurationVar(&limits.MinInterval, "min-interval", 0,
+		"Shortest interval allowed for a test. 0 means no limit.")
+	flag.DurationVar(&limits.MaxTimeout, "max-timeout", 0,
+		"Longest timeout allowed for a test. 0 means no limit.")
+	flag.BoolVar(&limits.Reject, "reject-outside-limits", false,
+		"Reject tests with an interval or timeout outside the limits, instead of using the limits.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -71,7 +94,15 @@ func main() {
 
 	cacheOpts := cache.Options{}
 	if restrictNamespace != "" {
+		// Cluster-scoped objects are not restricted by the namespaces of the cache. References of ClusterNetworktests are
+		// watched in the cluster resource namespace as well.
 		cacheOpts.DefaultNamespaces = map[string]cache.Config{restrictNamespace: cache.Config{}}
+		if clusterResourceNamespace != "" {
+			cacheOpts.DefaultNamespaces[clusterResourceNamespace] = cache.Config{}
+		}
+		cacheOpts.ByObject = map[client.Object]cache.ByObject{
+			&edgeworksnov2.Networktest{}: {Namespaces: map[string]cache.Config{restrictNamespace: {}}},
+		}
 		setupLog.Info("restrict watching to single namespace", "namespace", restrictNamespace)
 	}
 
@@ -92,13 +123,25 @@ func main() {
 	}
 
 	if err = (&controllers.NetworktestReconciler{
-		Client:      mgr.GetClient(),
-		Scheme:      mgr.GetScheme(),
-		TriggerChan: make(chan struct{}),
+		Client:               mgr.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		APIReader:            mgr.GetAPIReader(),
+		Recorder:             mgr.GetEventRecorderFor("networktester"),
+		Workers:              workers,
+		MaxConcurrentPerHost: maxConcurrentPerHost,
+		Limits:               limits,
+
+		ClusterResourceNamespace: clusterResourceNamespace,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Networktest")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err = webhooks.SetupNetworktestWebhookWithManager(mgr, limits); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Networktest")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -109,6 +152,13 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		// Not ready until the webhook server is serving, so the webhook Service only routes requests to pods answering them
+		if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
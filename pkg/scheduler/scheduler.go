@@ -0,0 +1,329 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RunFunc performs a run for the given key, and returns the time of the next run
+type RunFunc func(key types.NamespacedName) time.Time
+
+// Options configures concurrency of the scheduler
+type Options struct {
+	// Workers is the number of runs that can be in progress at the same time. Default 10.
+	Workers int
+
+	// MaxConcurrentPerHost limits the number of runs in progress against the same host. 0 means no limit.
+	MaxConcurrentPerHost int
+
+	// ObserveWait is called with the time a key waited for a worker after being due
+	ObserveWait func(time.Duration)
+}
+
+// Scheduler runs each scheduled key when it is due. Keys are kept in a min-heap ordered by next run, so the
+// scheduler sleeps until exactly the next due time instead of scanning all keys. Due keys are put in a ready
+// queue and run by a fixed number of workers. A key is never run concurrently with itself: it is pushed back
+// to the heap only when its run completes.
+type Scheduler struct {
+	run     RunFunc
+	options Options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   map[types.NamespacedName]*item
+	queue   queue
+	ready   []*item
+	hosts   map[string]int
+	wakeup  chan struct{}
+	stopped bool
+}
+
+type state int
+
+const (
+	queued state = iota
+	ready
+	running
+)
+
+type item struct {
+	key        types.NamespacedName
+	generation int64
+	host       string
+	nextRun    time.Time
+	state      state
+
+	// index in the heap while queued
+	index int
+
+	// rerun schedules a new run immediately after the current run completes, against pendingHost
+	rerun       bool
+	pendingHost string
+
+	// removed drops the item when the current run completes
+	removed bool
+}
+
+func New(run RunFunc, options Options) *Scheduler {
+	if options.Workers <= 0 {
+		options.Workers = 10
+	}
+
+	s := &Scheduler{
+		run:     run,
+		options: options,
+		items:   map[types.NamespacedName]*item{},
+		hosts:   map[string]int{},
+		wakeup:  make(chan struct{}, 1),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Schedule adds a key to run immediately. If the key is already scheduled with another generation, it is moved
+// to run immediately, or right after the current run if it is running. The host is used for limiting concurrent
+// runs against the same destination. Returns whether the key was added or updated.
+func (s *Scheduler) Schedule(key types.NamespacedName, generation int64, host string) (added bool, updated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.items[key]
+	if !found {
+		it = &item{key: key, generation: generation, host: host, nextRun: time.Now()}
+		s.items[key] = it
+		heap.Push(&s.queue, it)
+		s.notify()
+		return true, false
+	}
+
+	if it.generation == generation && !it.removed {
+		return false, false
+	}
+
+	it.generation = generation
+	switch it.state {
+	case running:
+		// Host is updated when the run completes, as the running count is kept for the old host
+		it.removed = false
+		it.rerun = true
+		it.pendingHost = host
+	case ready:
+		it.host = host
+	case queued:
+		it.host = host
+		it.nextRun = time.Now()
+		heap.Fix(&s.queue, it.index)
+		s.notify()
+	}
+	return false, true
+}
+
+// Remove stops further runs of the key. A run in progress is allowed to complete.
+func (s *Scheduler) Remove(key types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.items[key]
+	if !found {
+		return
+	}
+
+	switch it.state {
+	case running:
+		it.removed = true
+		it.rerun = false
+		return
+	case ready:
+		for i := range s.ready {
+			if s.ready[i] == it {
+				s.ready = append(s.ready[:i], s.ready[i+1:]...)
+				break
+			}
+		}
+	case queued:
+		heap.Remove(&s.queue, it.index)
+		s.notify()
+	}
+	delete(s.items, key)
+}
+
+// Len returns the number of scheduled keys
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// Waiting returns the number of keys that are due and waiting for a worker
+func (s *Scheduler) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ready)
+}
+
+// Start runs due keys until the context is cancelled, and waits for runs in progress to complete before returning
+func (s *Scheduler) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < s.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.worker()
+		}()
+	}
+
+	defer func() {
+		s.mu.Lock()
+		s.stopped = true
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		for len(s.queue) > 0 && !s.queue[0].nextRun.After(now) {
+			it := heap.Pop(&s.queue).(*item)
+			it.state = ready
+			s.ready = append(s.ready, it)
+			s.cond.Signal()
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if len(s.queue) > 0 {
+			timer = time.NewTimer(s.queue[0].nextRun.Sub(now))
+			due = timer.C
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		case <-s.wakeup:
+		case <-due:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// worker runs ready keys until the scheduler is stopped
+func (s *Scheduler) worker() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		it := s.next()
+		for it == nil {
+			if s.stopped {
+				return
+			}
+			s.cond.Wait()
+			it = s.next()
+		}
+
+		it.state = running
+		s.hosts[it.host]++
+		if s.options.ObserveWait != nil {
+			s.options.ObserveWait(time.Since(it.nextRun))
+		}
+		s.mu.Unlock()
+
+		next := s.run(it.key)
+
+		s.mu.Lock()
+		s.done(it, next)
+	}
+}
+
+// next removes and returns the first ready item where the host is below the concurrency limit. Must be called
+// with the lock held.
+func (s *Scheduler) next() *item {
+	if s.stopped {
+		return nil
+	}
+
+	for i, it := range s.ready {
+		if s.options.MaxConcurrentPerHost > 0 && it.host != "" && s.hosts[it.host] >= s.options.MaxConcurrentPerHost {
+			continue
+		}
+		s.ready = append(s.ready[:i], s.ready[i+1:]...)
+		return it
+	}
+	return nil
+}
+
+// done reschedules an item after its run has completed. Must be called with the lock held.
+func (s *Scheduler) done(it *item, next time.Time) {
+	s.hosts[it.host]--
+	if s.hosts[it.host] <= 0 {
+		delete(s.hosts, it.host)
+	}
+
+	// Items waiting for the host may now be able to run
+	s.cond.Broadcast()
+
+	if it.removed {
+		delete(s.items, it.key)
+		return
+	}
+
+	if it.rerun {
+		it.rerun = false
+		it.host = it.pendingHost
+		it.nextRun = time.Now()
+	} else {
+		it.nextRun = next
+	}
+	it.state = queued
+	heap.Push(&s.queue, it)
+	s.notify()
+}
+
+// notify wakes up the scheduler loop to recalculate the next due time. Must be called with the lock held.
+func (s *Scheduler) notify() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// queue is a min-heap of items ordered by next run
+type queue []*item
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool { return q[i].nextRun.Before(q[j].nextRun) }
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x any) {
+	it := x.(*item)
+	it.index = len(*q)
+	*q = append(*q, it)
+}
+
+func (q *queue) Pop() any {
+	old := *q
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*q = old[:n-1]
+	return it
+}
@@ -0,0 +1,220 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func start(t *testing.T, s *Scheduler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = s.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunsAtInterval(t *testing.T) {
+	var runs atomic.Int32
+	s := New(func(key types.NamespacedName) time.Time {
+		runs.Add(1)
+		return time.Now().Add(20 * time.Millisecond)
+	}, Options{})
+	start(t, s)
+
+	s.Schedule(types.NamespacedName{Namespace: "default", Name: "a"}, 1, "")
+	waitFor(t, func() bool { return runs.Load() >= 3 })
+}
+
+func TestOrdersByNextRun(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	s := New(func(key types.NamespacedName) time.Time {
+		mu.Lock()
+		order = append(order, key.Name)
+		mu.Unlock()
+		if key.Name == "slow" {
+			return time.Now().Add(time.Hour)
+		}
+		return time.Now().Add(30 * time.Millisecond)
+	}, Options{})
+	start(t, s)
+
+	s.Schedule(types.NamespacedName{Name: "slow"}, 1, "")
+	s.Schedule(types.NamespacedName{Name: "fast"}, 1, "")
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) >= 4
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	slow := 0
+	for _, n := range order {
+		if n == "slow" {
+			slow++
+		}
+	}
+	if slow != 1 {
+		t.Errorf("expected slow to run once, got %d runs in %v", slow, order)
+	}
+}
+
+func TestNoConcurrentRunsOfSameKey(t *testing.T) {
+	var inFlight, maxInFlight, runs atomic.Int32
+	key := types.NamespacedName{Namespace: "default", Name: "a"}
+	s := New(func(key types.NamespacedName) time.Time {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+		runs.Add(1)
+		return time.Now()
+	}, Options{})
+	start(t, s)
+
+	for g := int64(1); g <= 20; g++ {
+		s.Schedule(key, g, "")
+		time.Sleep(2 * time.Millisecond)
+	}
+	waitFor(t, func() bool { return runs.Load() >= 5 })
+
+	if maxInFlight.Load() != 1 {
+		t.Errorf("expected at most 1 run in flight, got %d", maxInFlight.Load())
+	}
+}
+
+func TestUpdateDuringRunTriggersRerun(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	key := types.NamespacedName{Name: "a"}
+	s := New(func(key types.NamespacedName) time.Time {
+		if runs.Add(1) == 1 {
+			<-release
+		}
+		return time.Now().Add(time.Hour)
+	}, Options{})
+	start(t, s)
+
+	s.Schedule(key, 1, "")
+	waitFor(t, func() bool { return runs.Load() == 1 })
+
+	if added, updated := s.Schedule(key, 2, ""); added || !updated {
+		t.Errorf("expected update, got added=%v updated=%v", added, updated)
+	}
+	close(release)
+	waitFor(t, func() bool { return runs.Load() == 2 })
+}
+
+func TestRemove(t *testing.T) {
+	var runs atomic.Int32
+	key := types.NamespacedName{Name: "a"}
+	s := New(func(key types.NamespacedName) time.Time {
+		runs.Add(1)
+		return time.Now().Add(10 * time.Millisecond)
+	}, Options{})
+	start(t, s)
+
+	s.Schedule(key, 1, "")
+	waitFor(t, func() bool { return runs.Load() >= 2 })
+	s.Remove(key)
+	waitFor(t, func() bool { return s.Len() == 0 })
+
+	after := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if runs.Load() != after {
+		t.Errorf("expected no runs after remove, got %d more", runs.Load()-after)
+	}
+}
+
+func concurrencyTracker() (enter func(), leave func(), max func() int32) {
+	var inFlight, maxInFlight atomic.Int32
+	enter = func() {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				return
+			}
+		}
+	}
+	leave = func() { inFlight.Add(-1) }
+	max = maxInFlight.Load
+	return
+}
+
+func TestWorkerLimit(t *testing.T) {
+	var runs atomic.Int32
+	enter, leave, max := concurrencyTracker()
+	s := New(func(key types.NamespacedName) time.Time {
+		enter()
+		time.Sleep(10 * time.Millisecond)
+		leave()
+		runs.Add(1)
+		return time.Now().Add(time.Hour)
+	}, Options{Workers: 3})
+	start(t, s)
+
+	for i := 0; i < 20; i++ {
+		s.Schedule(types.NamespacedName{Name: fmt.Sprintf("t%d", i)}, 1, fmt.Sprintf("host%d", i))
+	}
+	waitFor(t, func() bool { return runs.Load() == 20 })
+
+	if max() != 3 {
+		t.Errorf("expected 3 runs in flight, got %d", max())
+	}
+}
+
+func TestPerHostLimit(t *testing.T) {
+	var runs, otherRuns atomic.Int32
+	enter, leave, max := concurrencyTracker()
+	s := New(func(key types.NamespacedName) time.Time {
+		if key.Namespace == "other" {
+			otherRuns.Add(1)
+			return time.Now().Add(time.Hour)
+		}
+		enter()
+		time.Sleep(10 * time.Millisecond)
+		leave()
+		runs.Add(1)
+		return time.Now().Add(time.Hour)
+	}, Options{Workers: 5, MaxConcurrentPerHost: 2})
+	start(t, s)
+
+	for i := 0; i < 10; i++ {
+		s.Schedule(types.NamespacedName{Name: fmt.Sprintf("t%d", i)}, 1, "shared.example.com")
+	}
+	s.Schedule(types.NamespacedName{Namespace: "other", Name: "t"}, 1, "other.example.com")
+	waitFor(t, func() bool { return runs.Load() == 10 && otherRuns.Load() == 1 })
+
+	if max() != 2 {
+		t.Errorf("expected 2 runs in flight against shared host, got %d", max())
+	}
+}
@@ -0,0 +1,108 @@
+package testers
+
+import (
+	"bytes"
+	"edgeworks.no/networktester/api/v2"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const excerptLength = 128
+
+// ValidateHttpBody checks that the regular expression and JSONPath expression of the assertion can be parsed
+func ValidateHttpBody(a *v2.HTTPBodyAssertion) error {
+	if a == nil {
+		return nil
+	}
+
+	if a.Matches != "" {
+		if _, err := regexp.Compile(a.Matches); err != nil {
+			return fmt.Errorf("invalid regular expression: %v", err)
+		}
+	}
+
+	if a.JSONPath != nil {
+		if _, err := parseJSONPath(a.JSONPath.Expression); err != nil {
+			return fmt.Errorf("invalid JSONPath expression: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// checkBody reads up to the configured number of bytes from the body and evaluates the assertions.
+// An empty string is returned if all assertions hold, otherwise a description of the failed assertion.
+func checkBody(body io.Reader, a *v2.HTTPBodyAssertion) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(body, a.GetMaxBytes()))
+	if err != nil {
+		return "", fmt.Errorf("failed to read body: %w", err)
+	}
+
+	if a.Contains != "" && !bytes.Contains(data, []byte(a.Contains)) {
+		return fmt.Sprintf("body does not contain %q: %q", a.Contains, excerpt(data)), nil
+	}
+
+	if a.Matches != "" {
+		re, err := regexp.Compile(a.Matches)
+		if err != nil {
+			return "", fmt.Errorf("invalid regular expression: %v", err)
+		}
+		if !re.Match(data) {
+			return fmt.Sprintf("body does not match %q: %q", a.Matches, excerpt(data)), nil
+		}
+	}
+
+	if a.JSONPath != nil {
+		value, err := evaluateJSONPath(data, a.JSONPath.Expression)
+		if err != nil {
+			return fmt.Sprintf("jsonPath %s failed: %v: %q", a.JSONPath.Expression, err, excerpt(data)), nil
+		}
+		if value != a.JSONPath.Value {
+			return fmt.Sprintf("jsonPath %s is %q, expected %q", a.JSONPath.Expression, value, a.JSONPath.Value), nil
+		}
+	}
+
+	return "", nil
+}
+
+func parseJSONPath(expression string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+
+	jp := jsonpath.New("body")
+	if err := jp.Parse(expression); err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+func evaluateJSONPath(data []byte, expression string) (string, error) {
+	jp, err := parseJSONPath(expression)
+	if err != nil {
+		return "", err
+	}
+
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", fmt.Errorf("body is not valid JSON: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jp.Execute(&buf, obj); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func excerpt(data []byte) string {
+	if len(data) > excerptLength {
+		return string(data[:excerptLength]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,122 @@
+package testers
+
+import (
+	"edgeworks.no/networktester/api/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const healthBody = `{"status":"ok","checks":[{"name":"db","status":"degraded"}]}`
+
+func TestCheckBody(t *testing.T) {
+	long := strings.Repeat("x", excerptLength+20)
+
+	tests := []struct {
+		name      string
+		body      string
+		assertion v2.HTTPBodyAssertion
+
+		// failure is a part of the expected failure, or empty when all assertions should hold
+		failure string
+	}{
+		{name: "contains", body: healthBody, assertion: v2.HTTPBodyAssertion{Contains: `"status":"ok"`}},
+		{name: "does not contain", body: healthBody, assertion: v2.HTTPBodyAssertion{Contains: "healthy"}, failure: `body does not contain "healthy"`},
+		{name: "matches", body: healthBody, assertion: v2.HTTPBodyAssertion{Matches: `"name":"db","status":"(ok|degraded)"`}},
+		{name: "does not match", body: healthBody, assertion: v2.HTTPBodyAssertion{Matches: `^ok$`}, failure: `body does not match "^ok$"`},
+		{
+			name:      "json path",
+			body:      healthBody,
+			assertion: v2.HTTPBodyAssertion{JSONPath: &v2.JSONPathAssertion{Expression: ".status", Value: "ok"}},
+		},
+		{
+			name:      "json path with braces",
+			body:      healthBody,
+			assertion: v2.HTTPBodyAssertion{JSONPath: &v2.JSONPathAssertion{Expression: "{.checks[0].status}", Value: "degraded"}},
+		},
+		{
+			name:      "json path with other value",
+			body:      healthBody,
+			assertion: v2.HTTPBodyAssertion{JSONPath: &v2.JSONPathAssertion{Expression: ".checks[0].status", Value: "ok"}},
+			failure:   `jsonPath .checks[0].status is "degraded", expected "ok"`,
+		},
+		{
+			name:      "json path on other content",
+			body:      "<html>ok</html>",
+			assertion: v2.HTTPBodyAssertion{JSONPath: &v2.JSONPathAssertion{Expression: ".status", Value: "ok"}},
+			failure:   "body is not valid JSON",
+		},
+		{
+			name:      "invalid json path",
+			body:      healthBody,
+			assertion: v2.HTTPBodyAssertion{JSONPath: &v2.JSONPathAssertion{Expression: ".status[", Value: "ok"}},
+			failure:   "jsonPath .status[ failed",
+		},
+		{
+			// Every assertion must hold, the first one failing is reported
+			name:      "all assertions",
+			body:      healthBody,
+			assertion: v2.HTTPBodyAssertion{Contains: "status", Matches: "healthy", JSONPath: &v2.JSONPathAssertion{Expression: ".status", Value: "ok"}},
+			failure:   `body does not match "healthy"`,
+		},
+		{
+			name:      "excerpt of long body",
+			body:      long,
+			assertion: v2.HTTPBodyAssertion{Contains: "y"},
+			failure:   `"` + long[:excerptLength] + `..."`,
+		},
+		{
+			name:      "within max bytes",
+			body:      strings.Repeat(" ", 100) + "ok",
+			assertion: v2.HTTPBodyAssertion{Contains: "ok", MaxBytes: 102},
+		},
+		{
+			name:      "beyond max bytes",
+			body:      strings.Repeat(" ", 100) + "ok",
+			assertion: v2.HTTPBodyAssertion{Contains: "ok", MaxBytes: 101},
+			failure:   `body does not contain "ok"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			res, err := http.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			failure, err := checkBody(res.Body, &tt.assertion)
+			if err != nil {
+				t.Fatalf("checkBody() failed: %v", err)
+			}
+			if tt.failure == "" && failure != "" {
+				t.Errorf("checkBody() = %q, want all assertions to hold", failure)
+			} else if tt.failure != "" && !strings.Contains(failure, tt.failure) {
+				t.Errorf("checkBody() = %q, want a failure containing %q", failure, tt.failure)
+			}
+		})
+	}
+}
+
+func TestValidateHttpBody(t *testing.T) {
+	if err := ValidateHttpBody(nil); err != nil {
+		t.Errorf("ValidateHttpBody(nil) = %v", err)
+	}
+	if err := ValidateHttpBody(&v2.HTTPBodyAssertion{Matches: "^ok", JSONPath: &v2.JSONPathAssertion{Expression: ".status"}}); err != nil {
+		t.Errorf("ValidateHttpBody() of valid assertion = %v", err)
+	}
+	if err := ValidateHttpBody(&v2.HTTPBodyAssertion{Matches: "(ok"}); err == nil {
+		t.Errorf("ValidateHttpBody() accepted an invalid regular expression")
+	}
+	if err := ValidateHttpBody(&v2.HTTPBodyAssertion{JSONPath: &v2.JSONPathAssertion{Expression: ".status["}}); err == nil {
+		t.Errorf("ValidateHttpBody() accepted an invalid JSONPath expression")
+	}
+}
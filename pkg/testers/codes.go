@@ -0,0 +1,67 @@
+package testers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type codeRange struct {
+	from int
+	to   int
+}
+
+// ValidateExpectCodes checks that all entries are exact codes, ranges or classes of HTTP codes
+func ValidateExpectCodes(codes []string) error {
+	_, err := parseCodeRanges(codes)
+	return err
+}
+
+// parseCodeRanges parses entries like "200", "200-299" and "2xx" into ranges of HTTP codes
+func parseCodeRanges(codes []string) ([]codeRange, error) {
+	var ranges []codeRange
+
+	for _, c := range codes {
+		c = strings.TrimSpace(c)
+
+		var r codeRange
+		switch {
+		case len(c) == 3 && strings.HasSuffix(strings.ToLower(c), "xx"):
+			class, err := strconv.Atoi(c[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, fmt.Errorf("invalid code class: %s", c)
+			}
+			r = codeRange{from: class * 100, to: class*100 + 99}
+		case strings.Contains(c, "-"):
+			from, to, _ := strings.Cut(c, "-")
+			f, err1 := strconv.Atoi(strings.TrimSpace(from))
+			t, err2 := strconv.Atoi(strings.TrimSpace(to))
+			if err1 != nil || err2 != nil || f > t {
+				return nil, fmt.Errorf("invalid code range: %s", c)
+			}
+			r = codeRange{from: f, to: t}
+		default:
+			code, err := strconv.Atoi(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid code: %s", c)
+			}
+			r = codeRange{from: code, to: code}
+		}
+
+		if r.from < 100 || r.to > 599 {
+			return nil, fmt.Errorf("code out of range 100-599: %s", c)
+		}
+		ranges = append(ranges, r)
+	}
+
+	return ranges, nil
+}
+
+func inCodeRanges(code int, ranges []codeRange) bool {
+	for _, r := range ranges {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package testers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCodeRanges(t *testing.T) {
+	tests := []struct {
+		codes []string
+		want  []codeRange
+		err   bool
+	}{
+		{codes: nil, want: nil},
+		{codes: []string{"200"}, want: []codeRange{{200, 200}}},
+		{codes: []string{" 204 "}, want: []codeRange{{204, 204}}},
+		{codes: []string{"2xx", "3XX"}, want: []codeRange{{200, 299}, {300, 399}}},
+		{codes: []string{"301-302"}, want: []codeRange{{301, 302}}},
+		{codes: []string{"200 - 204"}, want: []codeRange{{200, 204}}},
+		{codes: []string{"100", "599"}, want: []codeRange{{100, 100}, {599, 599}}},
+		{codes: []string{"6xx"}, err: true},
+		{codes: []string{"0xx"}, err: true},
+		{codes: []string{"axx"}, err: true},
+		{codes: []string{"302-301"}, err: true},
+		{codes: []string{"200-"}, err: true},
+		{codes: []string{"ok"}, err: true},
+		{codes: []string{"99"}, err: true},
+		{codes: []string{"500-600"}, err: true},
+		{codes: []string{"200", "bad"}, err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCodeRanges(tt.codes)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseCodeRanges(%q) = %v, want error", tt.codes, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCodeRanges(%q) failed: %v", tt.codes, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCodeRanges(%q) = %v, want %v", tt.codes, got, tt.want)
+		}
+	}
+}
+
+func TestInCodeRanges(t *testing.T) {
+	ranges := []codeRange{{200, 299}, {304, 304}}
+
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{code: 200, want: true},
+		{code: 299, want: true},
+		{code: 304, want: true},
+		{code: 199, want: false},
+		{code: 301, want: false},
+		{code: 500, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := inCodeRanges(tt.code, ranges); got != tt.want {
+			t.Errorf("inCodeRanges(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package testers
+
+import (
+	"context"
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// maxConversationBuffer is the most data kept while waiting for a step to match, so a target sending endlessly
+// cannot exhaust the memory of the controller
+const maxConversationBuffer = 64 * 1024
+
+// maxQuotedData is the most received data included in result messages
+const maxQuotedData = 256
+
+// converse holds the conversation given by steps on an established connection. Data received is matched from where
+// the previous match ended. Traffic only counts as having reached the target when it has sent data, or no data was
+// expected, so a firewall that accepts connections and drops the traffic is not mistaken for the target, and its
+// outcome is classified from how waiting for data ended.
+func converse(ctx context.Context, conn net.Conn, steps []v2.TCPStep, timings *Timings) TestResult {
+	start := time.Now()
+	var pending []byte
+	received := 0
+	expected := false
+	buf := make([]byte, 4096)
+
+	for i, step := range steps {
+		if step.Expect != "" {
+			expected = true
+			re, err := regexp.Compile(step.Expect)
+			if err != nil {
+				return TestResult{
+					Success: false,
+					Reason:  FailureConfig,
+					Message: fmt.Errorf("step %d: invalid regular expression: %v", i, err).Error(),
+				}
+			}
+
+			deadline, _ := ctx.Deadline()
+			if step.ReadTimeout != nil {
+				if d := time.Now().Add(step.ReadTimeout.Duration); deadline.IsZero() || d.Before(deadline) {
+					deadline = d
+				}
+			}
+			_ = conn.SetReadDeadline(deadline)
+
+			for {
+				if loc := re.FindIndex(pending); loc != nil {
+					pending = pending[loc[1]:]
+					break
+				}
+				if len(pending) > maxConversationBuffer {
+					return TestResult{
+						Success:   false,
+						Connected: true,
+						Reason:    FailureAssertion,
+						Message:   fmt.Sprintf("step %d: received more than %d bytes without matching %q", i, maxConversationBuffer, step.Expect),
+						Outcome:   v2.OutcomeConnected,
+					}
+				}
+
+				n, err := conn.Read(buf)
+				if n > 0 {
+					if received == 0 {
+						timings.FirstByte = time.Since(start)
+					}
+					received += n
+					pending = append(pending, buf[:n]...)
+					continue
+				}
+				if err == nil {
+					continue
+				}
+
+				// Data that does not match is an answer from the target, just not the expected one
+				result := TestResult{
+					Success:   false,
+					Connected: received > 0,
+					Reason:    classifyError(err),
+					Message:   fmt.Sprintf("step %d: %q did not match, received %s: %v", i, step.Expect, quoteData(pending), err),
+					Outcome:   v2.OutcomeConnected,
+				}
+				if len(pending) > 0 {
+					result.Reason = FailureAssertion
+				}
+				if received == 0 {
+					result.Outcome = classifyOutcome(err)
+				}
+				return result
+			}
+		}
+
+		if step.Send != "" {
+			data, err := decodePayload(step.Send, step.GetEncoding())
+			if err != nil {
+				return TestResult{
+					Success: false,
+					Reason:  FailureConfig,
+					Message: fmt.Errorf("step %d: %v", i, err).Error(),
+				}
+			}
+			if _, err := conn.Write(data); err != nil {
+				result := TestResult{
+					Success:   false,
+					Connected: received > 0 || !expected,
+					Reason:    classifyError(err),
+					Message:   fmt.Errorf("step %d: failed to write data: %v", i, err).Error(),
+					Outcome:   v2.OutcomeConnected,
+				}
+				if !result.Connected {
+					result.Outcome = classifyOutcome(err)
+				}
+				return result
+			}
+		}
+	}
+
+	return TestResult{
+		Success:   true,
+		Connected: true,
+		Message:   fmt.Sprintf("%s: %d steps completed, received %d bytes", conn.RemoteAddr(), len(steps), received),
+		Outcome:   v2.OutcomeConnected,
+	}
+}
+
+// quoteData quotes received data for a result message, truncated to maxQuotedData bytes
+func quoteData(data []byte) string {
+	if len(data) == 0 {
+		return "nothing"
+	}
+	if len(data) > maxQuotedData {
+		return fmt.Sprintf("%q...", data[:maxQuotedData])
+	}
+	return fmt.Sprintf("%q", data)
+}
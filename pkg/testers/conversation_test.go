@@ -0,0 +1,159 @@
+package testers
+
+import (
+	"bufio"
+	"context"
+	"edgeworks.no/networktester/api/v2"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConverse(t *testing.T) {
+	readTimeout := &metav1.Duration{Duration: 50 * time.Millisecond}
+
+	tests := []struct {
+		name string
+
+		// target plays the other end of the connection
+		target    func(conn net.Conn)
+		steps     []v2.TCPStep
+		success   bool
+		reason    FailureReason
+		connected bool
+		outcome   string
+		message   string
+	}{
+		{
+			name: "request and response",
+			target: func(conn net.Conn) {
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				if line == "PING\r\n" {
+					_, _ = conn.Write([]byte("+PONG\r\n"))
+				}
+			},
+			steps: []v2.TCPStep{
+				{Send: "50 49 4e 47 0d 0a", Encoding: v2.EncodingHex},
+				{Expect: `^\+PONG`},
+			},
+			success:   true,
+			connected: true,
+			outcome:   v2.OutcomeConnected,
+		},
+		{
+			name: "banner split over reads",
+			target: func(conn net.Conn) {
+				_, _ = conn.Write([]byte("SSH-"))
+				_, _ = conn.Write([]byte("2.0-OpenSSH_9.6\r\n"))
+			},
+			steps:     []v2.TCPStep{{Expect: `^SSH-2\.0-`}},
+			success:   true,
+			connected: true,
+			outcome:   v2.OutcomeConnected,
+		},
+		{
+			name: "matches from where the previous match ended",
+			target: func(conn net.Conn) {
+				_, _ = conn.Write([]byte("ab"))
+			},
+			steps:     []v2.TCPStep{{Expect: "a"}, {Expect: "^b"}},
+			success:   true,
+			connected: true,
+			outcome:   v2.OutcomeConnected,
+		},
+		{
+			name: "data already matched is not matched again",
+			target: func(conn net.Conn) {
+				_, _ = conn.Write([]byte("ab"))
+			},
+			steps:     []v2.TCPStep{{Expect: "a"}, {Expect: "a", ReadTimeout: readTimeout}},
+			reason:    FailureAssertion,
+			connected: true,
+			outcome:   v2.OutcomeConnected,
+			message:   `step 1: "a" did not match, received "b"`,
+		},
+		{
+			name: "unexpected answer",
+			target: func(conn net.Conn) {
+				_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
+			},
+			steps:     []v2.TCPStep{{Expect: `^SSH-2\.0-`, ReadTimeout: readTimeout}},
+			reason:    FailureAssertion,
+			connected: true,
+			outcome:   v2.OutcomeConnected,
+			message:   `received "HTTP/1.1 400 Bad Request\r\n"`,
+		},
+		{
+			name:    "silent target",
+			target:  func(conn net.Conn) {},
+			steps:   []v2.TCPStep{{Expect: "^220 ", ReadTimeout: readTimeout}},
+			reason:  FailureTimeout,
+			outcome: v2.OutcomeFiltered,
+			message: "received nothing",
+		},
+		{
+			name: "closed before answering",
+			target: func(conn net.Conn) {
+				_ = conn.Close()
+			},
+			steps:   []v2.TCPStep{{Expect: "^220 "}},
+			reason:  FailureReset,
+			outcome: v2.OutcomeReset,
+		},
+		{
+			name:   "invalid regular expression",
+			target: func(conn net.Conn) {},
+			steps:  []v2.TCPStep{{Expect: "("}},
+			reason: FailureConfig,
+		},
+		{
+			name:   "invalid payload",
+			target: func(conn net.Conn) {},
+			steps:  []v2.TCPStep{{Send: "zz", Encoding: v2.EncodingHex}},
+			reason: FailureConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, target := net.Pipe()
+			t.Cleanup(func() {
+				_ = client.Close()
+				_ = target.Close()
+			})
+			go tt.target(target)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			var timings Timings
+			result := converse(ctx, client, tt.steps, &timings)
+
+			if result.Success != tt.success || result.Reason != tt.reason || result.Connected != tt.connected || result.Outcome != tt.outcome {
+				t.Errorf("converse() = %+v, want success %v, reason %q, connected %v and outcome %q",
+					result, tt.success, tt.reason, tt.connected, tt.outcome)
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("converse() message = %q, want it to contain %q", result.Message, tt.message)
+			}
+			if tt.success && timings.FirstByte == 0 {
+				t.Errorf("converse() did not record the time to first byte")
+			}
+		})
+	}
+}
+
+func TestQuoteData(t *testing.T) {
+	if got := quoteData(nil); got != "nothing" {
+		t.Errorf("quoteData(nil) = %q, want nothing", got)
+	}
+	if got := quoteData([]byte("220 ready\r\n")); got != `"220 ready\r\n"` {
+		t.Errorf("quoteData() = %q", got)
+	}
+	if got := quoteData([]byte(strings.Repeat("a", maxQuotedData+1))); !strings.HasSuffix(got, `a"...`) || len(got) != maxQuotedData+5 {
+		t.Errorf("quoteData() of long data = %q, want it truncated", got)
+	}
+}
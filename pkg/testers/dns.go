@@ -0,0 +1,170 @@
+package testers
+
+import (
+	"context"
+	"edgeworks.no/networktester/api/v2"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+func doDNSTest(spec *v2.NetworktestSpec) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
+	defer cancelFunc()
+
+	resolver, server := newResolver(spec.DNS.Nameserver)
+	recordType := spec.DNS.GetRecordType()
+
+	start := time.Now()
+	answers, err := lookup(ctx, resolver, recordType, spec.DNS.Name)
+	timings := Timings{DNSLookup: time.Since(start)}
+	defer func() {
+		result.Timings = timings
+	}()
+
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return TestResult{
+				Success: false,
+				Reason:  FailureTimeout,
+				Message: fmt.Errorf("timeout: %v (resolver %s)", err, server).Error(),
+			}
+		}
+
+		// A not found answer means the resolver could be reached
+		var dnsErr *net.DNSError
+		return TestResult{
+			Success:   false,
+			Reason:    FailureDNSError,
+			Connected: errors.As(err, &dnsErr) && dnsErr.IsNotFound,
+			Message:   fmt.Sprintf("%v (resolver %s)", err, server),
+		}
+	}
+
+	answerList := strings.Join(answers, ", ")
+	for _, expected := range spec.DNS.ExpectedAnswers {
+		if !matchesAnswer(expected, answers, recordType) {
+			return TestResult{
+				Success:   false,
+				Reason:    FailureAssertion,
+				Connected: true,
+				Message:   fmt.Sprintf("%s %s: expected answer %s not found in [%s] (resolver %s)", recordType, spec.DNS.Name, expected, answerList, server),
+			}
+		}
+	}
+
+	return TestResult{
+		Success:   true,
+		Connected: true,
+		Message:   fmt.Sprintf("%s %s: [%s] (resolver %s)", recordType, spec.DNS.Name, answerList, server),
+	}
+}
+
+// newResolver returns a resolver sending all queries to the given nameserver, together with
+// a description of the resolver for use in result messages.
+func newResolver(nameserver string) (*net.Resolver, string) {
+	if nameserver == "" {
+		return net.DefaultResolver, "system"
+	}
+
+	if _, _, err := net.SplitHostPort(nameserver); err != nil {
+		nameserver = net.JoinHostPort(nameserver, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, nameserver)
+		},
+	}, nameserver
+}
+
+func lookup(ctx context.Context, r *net.Resolver, recordType string, name string) ([]string, error) {
+	var answers []string
+
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, trimDot(cname))
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, trimDot(mx.Host)))
+		}
+	case "TXT":
+		txts, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, txts...)
+	case "SRV":
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, trimDot(srv.Target)))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type: %s", recordType)
+	}
+
+	return answers, nil
+}
+
+// matchesAnswer checks if the expected value is among the answers. For MX and SRV records the expected
+// value may be either the full record or only the target host name.
+func matchesAnswer(expected string, answers []string, recordType string) bool {
+	if recordType != "TXT" {
+		expected = strings.ToLower(trimDot(expected))
+	}
+
+	for _, a := range answers {
+		if recordType == "TXT" {
+			if a == expected {
+				return true
+			}
+			continue
+		}
+
+		a = strings.ToLower(a)
+		if a == expected {
+			return true
+		}
+
+		if ip := net.ParseIP(expected); ip != nil && ip.Equal(net.ParseIP(a)) {
+			return true
+		}
+
+		fields := strings.Fields(a)
+		if (recordType == "MX" || recordType == "SRV") && len(fields) > 0 && fields[len(fields)-1] == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func trimDot(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
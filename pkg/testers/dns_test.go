@@ -0,0 +1,34 @@
+package testers
+
+import "testing"
+
+func TestMatchesAnswer(t *testing.T) {
+	tests := []struct {
+		expected   string
+		answers    []string
+		recordType string
+		want       bool
+	}{
+		{expected: "10.96.0.1", answers: []string{"10.96.0.1"}, recordType: "A", want: true},
+		{expected: "10.96.0.2", answers: []string{"10.96.0.1"}, recordType: "A", want: false},
+		{expected: "2001:DB8::1", answers: []string{"2001:db8::1"}, recordType: "AAAA", want: true},
+		{expected: "2001:db8:0:0::1", answers: []string{"2001:db8::1"}, recordType: "AAAA", want: true},
+		{expected: "Web.Example.com.", answers: []string{"web.example.com"}, recordType: "CNAME", want: true},
+		{expected: "10 mail.example.com", answers: []string{"10 mail.example.com"}, recordType: "MX", want: true},
+		{expected: "mail.example.com.", answers: []string{"20 backup.example.com", "10 mail.example.com"}, recordType: "MX", want: true},
+		{expected: "20 mail.example.com", answers: []string{"10 mail.example.com"}, recordType: "MX", want: false},
+		{expected: "sip.example.com", answers: []string{"10 60 5060 sip.example.com"}, recordType: "SRV", want: true},
+		{expected: "example.com", answers: []string{"10 60 5060 sip.example.com"}, recordType: "SRV", want: false},
+		// Only MX and SRV records may be matched by the target host name
+		{expected: "example.com", answers: []string{"v=spf1 include:example.com"}, recordType: "TXT", want: false},
+		{expected: "v=spf1 -all", answers: []string{"v=spf1 -all"}, recordType: "TXT", want: true},
+		{expected: "V=SPF1 -all", answers: []string{"v=spf1 -all"}, recordType: "TXT", want: false},
+		{expected: "10.96.0.1", answers: nil, recordType: "A", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesAnswer(tt.expected, tt.answers, tt.recordType); got != tt.want {
+			t.Errorf("matchesAnswer(%q, %q, %s) = %v, want %v", tt.expected, tt.answers, tt.recordType, got, tt.want)
+		}
+	}
+}
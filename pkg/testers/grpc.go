@@ -0,0 +1,193 @@
+package testers
+
+import (
+	"context"
+	"crypto/tls"
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func doGRPCTest(spec *v2.NetworktestSpec, tlsMaterial *TLSMaterial) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
+	defer cancelFunc()
+
+	conn := &grpcConnection{}
+	defer func() {
+		result.Timings = conn.result().timings
+	}()
+
+	p := spec.GRPC
+	creds := insecure.NewCredentials()
+	if p.TLS {
+		config := &tls.Config{
+			ServerName:         p.ServerName,
+			InsecureSkipVerify: p.TLSSkipVerify,
+			RootCAs:            tlsMaterial.RootCAs,
+		}
+		if tlsMaterial.ClientCertificate != nil {
+			config.Certificates = []tls.Certificate{*tlsMaterial.ClientCertificate}
+		}
+		creds = credentials.NewTLS(config)
+	}
+
+	// The passthrough resolver hands the address to the dialer as is, so the name lookup is timed like other probes
+	client, err := grpc.NewClient("passthrough:///"+net.JoinHostPort(p.Address, strconv.Itoa(p.Port)),
+		grpc.WithTransportCredentials(recordingCredentials{TransportCredentials: creds, conn: conn}),
+		grpc.WithContextDialer(conn.dialer(p.Address, p.Port)),
+	)
+	if err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  FailureConfig,
+			Message: err.Error(),
+		}
+	}
+	defer client.Close()
+
+	md := metadata.MD{}
+	for _, h := range p.Metadata {
+		md.Append(h.Name, h.Value)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	start := time.Now()
+	resp, err := healthpb.NewHealthClient(client).Check(ctx, &healthpb.HealthCheckRequest{Service: p.Service})
+	if err != nil {
+		return grpcFailure(err, conn.result())
+	}
+	conn.firstByte(time.Since(start))
+
+	target := "server"
+	if p.Service != "" {
+		target = fmt.Sprintf("service %q", p.Service)
+	}
+
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return TestResult{
+			Success:   false,
+			Connected: true,
+			Reason:    FailureAssertion,
+			Message:   fmt.Sprintf("%s is %s", target, resp.GetStatus()),
+		}
+	}
+
+	return TestResult{
+		Success:   true,
+		Connected: true,
+		Message:   fmt.Sprintf("%s is %s", target, resp.GetStatus()),
+	}
+}
+
+// grpcFailure classifies a failed health check. gRPC only reports failing to connect as an Unavailable status, so
+// the error of the connection attempt is used when there is one.
+func grpcFailure(err error, attempt grpcAttempt) TestResult {
+	st := status.Convert(err)
+
+	if attempt.err != nil {
+		return TestResult{
+			Success:   false,
+			Connected: attempt.connected,
+			Reason:    classifyError(attempt.err),
+			Message:   attempt.err.Error(),
+		}
+	}
+
+	result := TestResult{
+		Success:   false,
+		Connected: attempt.connected,
+		Reason:    FailureOther,
+		Message:   fmt.Sprintf("health check failed: %s: %s", st.Code(), st.Message()),
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		result.Reason = FailureTimeout
+	case codes.NotFound:
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("service is not known by the health server: %s", st.Message())
+	case codes.Unimplemented:
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("health checking is not implemented by the server: %s", st.Message())
+	}
+	return result
+}
+
+// grpcConnection records the timings and errors of the connection gRPC makes in the background for a probe run
+type grpcConnection struct {
+	mu      sync.Mutex
+	attempt grpcAttempt
+}
+
+type grpcAttempt struct {
+	timings Timings
+
+	// connected is true when a TCP connection was established
+	connected bool
+
+	// err is the error of the last failed connection attempt or TLS handshake, if any
+	err error
+}
+
+func (c *grpcConnection) result() grpcAttempt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempt
+}
+
+func (c *grpcConnection) firstByte(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempt.timings.FirstByte = d
+}
+
+// dialer returns a gRPC dialer connecting to the host and port, recording the time spent on each phase
+func (c *grpcConnection) dialer(host string, port int) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, _ string) (net.Conn, error) {
+		var timings Timings
+		conn, err := dialTimed(ctx, "tcp", host, port, &timings)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.attempt.timings.DNSLookup = timings.DNSLookup
+		c.attempt.timings.Connect = timings.Connect
+		c.attempt.err = err
+		if err == nil {
+			c.attempt.connected = true
+		}
+		return conn, err
+	}
+}
+
+// recordingCredentials records the time spent on the TLS handshake, and its error, on the connection
+type recordingCredentials struct {
+	credentials.TransportCredentials
+	conn *grpcConnection
+}
+
+func (r recordingCredentials) ClientHandshake(ctx context.Context, authority string, raw net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	start := time.Now()
+	conn, info, err := r.TransportCredentials.ClientHandshake(ctx, authority, raw)
+
+	r.conn.mu.Lock()
+	defer r.conn.mu.Unlock()
+	if r.TransportCredentials.Info().SecurityProtocol == "tls" {
+		r.conn.attempt.timings.TLSHandshake = time.Since(start)
+	}
+	r.conn.attempt.err = err
+	return conn, info, err
+}
+
+func (r recordingCredentials) Clone() credentials.TransportCredentials {
+	return recordingCredentials{TransportCredentials: r.TransportCredentials.Clone(), conn: r.conn}
+}
@@ -0,0 +1,126 @@
+package testers
+
+import (
+	"crypto/tls"
+	"edgeworks.no/networktester/api/v2"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// startGRPC starts a gRPC server on a loopback port, with the health server registered unless it is nil
+func startGRPC(t *testing.T, healthServer *health.Server, opts ...grpc.ServerOption) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer(opts...)
+	if healthServer != nil {
+		healthpb.RegisterHealthServer(server, healthServer)
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func grpcSpec(probe v2.GRPCProbe) *v2.NetworktestSpec {
+	return &v2.NetworktestSpec{
+		Timeout: &metav1.Duration{Duration: 2 * time.Second},
+		GRPC:    &probe,
+	}
+}
+
+func TestGRPCProbe(t *testing.T) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("payments", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	port := startGRPC(t, healthServer)
+
+	t.Run("server serving", func(t *testing.T) {
+		result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port}), &TLSMaterial{})
+		if !result.Success || !result.Connected || result.Message != "server is SERVING" {
+			t.Errorf("doGRPCTest() = %+v, want the server to be serving", result)
+		}
+		if result.Timings.Connect == 0 || result.Timings.FirstByte == 0 {
+			t.Errorf("doGRPCTest() timings = %+v, want connect and first byte", result.Timings)
+		}
+		if result.Timings.TLSHandshake != 0 {
+			t.Errorf("doGRPCTest() recorded a TLS handshake on a plaintext connection")
+		}
+	})
+
+	t.Run("service serving", func(t *testing.T) {
+		result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port, Service: "orders"}), &TLSMaterial{})
+		if !result.Success || result.Message != `service "orders" is SERVING` {
+			t.Errorf("doGRPCTest() = %+v, want the service to be serving", result)
+		}
+	})
+
+	t.Run("service not serving", func(t *testing.T) {
+		result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port, Service: "payments"}), &TLSMaterial{})
+		if result.Success || !result.Connected || result.Reason != FailureAssertion || result.Message != `service "payments" is NOT_SERVING` {
+			t.Errorf("doGRPCTest() = %+v, want an assertion failure for the service not serving", result)
+		}
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port, Service: "billing"}), &TLSMaterial{})
+		if result.Success || !result.Connected || result.Reason != FailureAssertion || !strings.Contains(result.Message, "service is not known by the health server") {
+			t.Errorf("doGRPCTest() = %+v, want an assertion failure for the unknown service", result)
+		}
+	})
+}
+
+func TestGRPCProbeWithoutHealthService(t *testing.T) {
+	port := startGRPC(t, nil)
+
+	result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port}), &TLSMaterial{})
+	if result.Success || result.Reason != FailureAssertion || !strings.Contains(result.Message, "health checking is not implemented") {
+		t.Errorf("doGRPCTest() = %+v, want an assertion failure for the missing health service", result)
+	}
+}
+
+func TestGRPCProbeTLS(t *testing.T) {
+	ca := newTestCA(t)
+	creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{ca.certificate(t, 30*24*time.Hour)}})
+	port := startGRPC(t, health.NewServer(), grpc.Creds(creds))
+
+	result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port, TLS: true, ServerName: "localhost"}), &TLSMaterial{RootCAs: ca.pool})
+	if !result.Success {
+		t.Fatalf("doGRPCTest() = %+v, want success", result)
+	}
+	if result.Timings.TLSHandshake == 0 {
+		t.Errorf("doGRPCTest() did not record the time of the handshake")
+	}
+
+	// The handshake error is reported rather than gRPC's Unavailable status
+	result = doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port, TLS: true, ServerName: "localhost"}), &TLSMaterial{})
+	if result.Success || !result.Connected || result.Reason != FailureTLSError {
+		t.Errorf("doGRPCTest() with an unknown authority = %+v, want a TLS error", result)
+	}
+}
+
+func TestGRPCProbeNotListening(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	result := doGRPCTest(grpcSpec(v2.GRPCProbe{Address: "127.0.0.1", Port: port}), &TLSMaterial{})
+	if result.Success || result.Connected || result.Reason != FailureRefused {
+		t.Errorf("doGRPCTest() = %+v, want a refused connection", result)
+	}
+}
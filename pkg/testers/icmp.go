@@ -0,0 +1,293 @@
+package testers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// PingStats are the packet loss and round trip times of a run of an ICMP probe
+type PingStats struct {
+	Sent     int
+	Received int
+	MinRTT   time.Duration
+	AvgRTT   time.Duration
+	MaxRTT   time.Duration
+
+	// Jitter is the mean difference between the round trip times of consecutive replies
+	Jitter time.Duration
+}
+
+// PacketLoss returns the percentage of echo requests without reply
+func (p PingStats) PacketLoss() float64 {
+	if p.Sent == 0 {
+		return 0
+	}
+	return float64(p.Sent-p.Received) / float64(p.Sent) * 100
+}
+
+func (p PingStats) String() string {
+	s := fmt.Sprintf("%d sent, %d received, %.0f%% packet loss", p.Sent, p.Received, p.PacketLoss())
+	if p.Received > 0 {
+		s += fmt.Sprintf(", rtt min/avg/max %s/%s/%s, jitter %s", p.MinRTT, p.AvgRTT, p.MaxRTT, p.Jitter)
+	}
+	return s
+}
+
+func doICMPTest(spec *v2.NetworktestSpec) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
+	defer cancelFunc()
+
+	var timings Timings
+	defer func() {
+		result.Timings = timings
+	}()
+
+	p := spec.ICMP
+	ip, err := resolveIP(ctx, p.Address, &timings)
+	if err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  classifyError(err),
+			Message: err.Error(),
+		}
+	}
+
+	conn, raw, err := listenICMP(ip)
+	if err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  FailureOther,
+			Message: fmt.Errorf("failed to open ICMP socket: %v", err).Error(),
+		}
+	}
+	defer conn.Close()
+
+	stats, err := ping(ctx, conn, raw, ip, p.GetCount(), p.GetPacketInterval())
+	if err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  classifyError(err),
+			Message: fmt.Errorf("failed to send echo request: %v", err).Error(),
+			Ping:    &stats,
+		}
+	}
+
+	result = TestResult{
+		Success:   true,
+		Connected: stats.Received > 0,
+		Message:   fmt.Sprintf("%s: %s", ip, stats),
+		Ping:      &stats,
+	}
+
+	switch {
+	case stats.Received == 0:
+		result.Success = false
+		result.Reason = FailureTimeout
+		result.Message = fmt.Sprintf("no reply from %s: %s", ip, stats)
+	case stats.PacketLoss() > float64(p.MaxPacketLoss):
+		result.Success = false
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("packet loss above %d%%: %s", p.MaxPacketLoss, stats)
+	case p.MaxRTT != nil && stats.AvgRTT > p.MaxRTT.Duration:
+		result.Success = false
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("average rtt above %s: %s", p.MaxRTT.Duration, stats)
+	case p.MaxJitter != nil && stats.Jitter > p.MaxJitter.Duration:
+		result.Success = false
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("jitter above %s: %s", p.MaxJitter.Duration, stats)
+	}
+
+	return result
+}
+
+// resolveIP returns the address of the host, preferring IPv4, recording the time spent on name lookup
+func resolveIP(ctx context.Context, host string, timings *Timings) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	timings.DNSLookup = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+	return addrs[0].IP, nil
+}
+
+// listenICMP opens an unprivileged ICMP datagram socket, allowed to the groups in the net.ipv4.ping_group_range sysctl,
+// and falls back to a raw socket, which requires CAP_NET_RAW. Returns whether the socket is raw.
+func listenICMP(ip net.IP) (*icmp.PacketConn, bool, error) {
+	network, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if ip.To4() == nil {
+		network, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return conn, false, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr != nil {
+		return nil, false, fmt.Errorf("datagram socket: %v, raw socket: %v", err, rawErr)
+	}
+	return conn, true, nil
+}
+
+// ping sends count echo requests, interval apart, and waits for the replies until the context is done. The kernel
+// sets the ID of echo requests sent from datagram sockets and only delivers the replies to them, while raw sockets
+// receive all replies, so replies are matched by ID, sequence number and a random payload.
+func ping(ctx context.Context, conn *icmp.PacketConn, raw bool, ip net.IP, count int, interval time.Duration) (PingStats, error) {
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if ip.To4() == nil {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if raw {
+		dst = &net.IPAddr{IP: ip}
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return PingStats{}, err
+	}
+	id := int(token[0])<<8 | int(token[1])
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+
+	var mu sync.Mutex
+	sentAt := make([]time.Time, count)
+	rtts := make([]time.Duration, count)
+	replied := make([]bool, count)
+	received := 0
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			now := time.Now()
+
+			msg, err := icmp.ParseMessage(replyType.Protocol(), buf[:n])
+			if err != nil || msg.Type != replyType {
+				continue
+			}
+			echo, ok := msg.Body.(*icmp.Echo)
+			if !ok || (raw && echo.ID != id) || !bytes.Equal(echo.Data, token) {
+				continue
+			}
+
+			mu.Lock()
+			seq := echo.Seq
+			if seq >= 0 && seq < count && !sentAt[seq].IsZero() && !replied[seq] {
+				rtts[seq] = now.Sub(sentAt[seq])
+				replied[seq] = true
+				received++
+			}
+			all := received == count
+			mu.Unlock()
+			if all {
+				return
+			}
+		}
+	}()
+
+	stats := PingStats{}
+	var sendErr error
+send:
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				break send
+			}
+		}
+
+		b, err := (&icmp.Message{Type: echoType, Body: &icmp.Echo{ID: id, Seq: seq, Data: token}}).Marshal(nil)
+		if err != nil {
+			sendErr = err
+			break
+		}
+		mu.Lock()
+		sentAt[seq] = time.Now()
+		mu.Unlock()
+		if _, err := conn.WriteTo(b, dst); err != nil {
+			sendErr = err
+			break
+		}
+		stats.Sent++
+	}
+
+	// Stop waiting for replies when sending failed, otherwise wait until all are received or the context is done
+	if sendErr != nil {
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	stats.Received = received
+	if sendErr != nil && stats.Sent == 0 {
+		return stats, sendErr
+	}
+
+	var replies []time.Duration
+	for seq := 0; seq < count; seq++ {
+		if replied[seq] {
+			replies = append(replies, rtts[seq])
+		}
+	}
+	stats.summarize(replies)
+
+	return stats, nil
+}
+
+// summarize sets the round trip times and jitter from the round trip times of the replies, in order of sequence number
+func (p *PingStats) summarize(rtts []time.Duration) {
+	var sum, jitterSum time.Duration
+	for i, rtt := range rtts {
+		if i == 0 || rtt < p.MinRTT {
+			p.MinRTT = rtt
+		}
+		if rtt > p.MaxRTT {
+			p.MaxRTT = rtt
+		}
+		if i > 0 {
+			jitterSum += time.Duration(math.Abs(float64(rtt - rtts[i-1])))
+		}
+		sum += rtt
+	}
+	if len(rtts) > 0 {
+		p.AvgRTT = sum / time.Duration(len(rtts))
+	}
+	if len(rtts) > 1 {
+		p.Jitter = jitterSum / time.Duration(len(rtts)-1)
+	}
+}
@@ -0,0 +1,61 @@
+package testers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingStatsSummarize(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name string
+		rtts []time.Duration
+		want PingStats
+	}{
+		{name: "no replies", rtts: nil, want: PingStats{}},
+		{name: "single reply", rtts: []time.Duration{10 * ms}, want: PingStats{MinRTT: 10 * ms, AvgRTT: 10 * ms, MaxRTT: 10 * ms}},
+		{name: "steady", rtts: []time.Duration{5 * ms, 5 * ms, 5 * ms}, want: PingStats{MinRTT: 5 * ms, AvgRTT: 5 * ms, MaxRTT: 5 * ms}},
+		{
+			// Jitter is the mean of |20-10|, |15-20| and |35-15|
+			name: "varying",
+			rtts: []time.Duration{10 * ms, 20 * ms, 15 * ms, 35 * ms},
+			want: PingStats{MinRTT: 10 * ms, AvgRTT: 20 * ms, MaxRTT: 35 * ms, Jitter: 35 * ms / 3},
+		},
+	}
+
+	for _, tt := range tests {
+		var got PingStats
+		got.summarize(tt.rtts)
+		if got != tt.want {
+			t.Errorf("%s: summarize(%v) = %+v, want %+v", tt.name, tt.rtts, got, tt.want)
+		}
+	}
+}
+
+func TestPingStatsPacketLoss(t *testing.T) {
+	if loss := (PingStats{}).PacketLoss(); loss != 0 {
+		t.Errorf("PacketLoss() without requests = %v, want 0", loss)
+	}
+	if loss := (PingStats{Sent: 5, Received: 5}).PacketLoss(); loss != 0 {
+		t.Errorf("PacketLoss() with all replies = %v, want 0", loss)
+	}
+	if loss := (PingStats{Sent: 4, Received: 1}).PacketLoss(); loss != 75 {
+		t.Errorf("PacketLoss() with 1 of 4 replies = %v, want 75", loss)
+	}
+	if loss := (PingStats{Sent: 3}).PacketLoss(); loss != 100 {
+		t.Errorf("PacketLoss() without replies = %v, want 100", loss)
+	}
+}
+
+func TestPingStatsString(t *testing.T) {
+	// Round trip times are left out when there were no replies
+	if got := (PingStats{Sent: 3}).String(); got != "3 sent, 0 received, 100% packet loss" {
+		t.Errorf("String() without replies = %q", got)
+	}
+
+	stats := PingStats{Sent: 2, Received: 2, MinRTT: time.Millisecond, AvgRTT: 2 * time.Millisecond, MaxRTT: 3 * time.Millisecond, Jitter: 2 * time.Millisecond}
+	if got, want := stats.String(), "2 sent, 2 received, 0% packet loss, rtt min/avg/max 1ms/2ms/3ms, jitter 2ms"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
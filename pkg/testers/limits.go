@@ -0,0 +1,50 @@
+package testers
+
+import (
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Limits bounds the interval and timeout of all tests, so a single test cannot keep the workers busy or flood the
+// target. Set for the whole controller.
+type Limits struct {
+	// MinInterval is the shortest interval allowed. 0 means no limit.
+	MinInterval time.Duration
+
+	// MaxTimeout is the longest timeout allowed. 0 means no limit.
+	MaxTimeout time.Duration
+
+	// Reject rejects tests outside the limits. Otherwise, the interval and timeout are clamped to the limits.
+	Reject bool
+}
+
+// Check returns an error for each limit the spec is outside of
+func (l Limits) Check(spec v2.NetworktestSpec) field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+
+	if interval := spec.GetInterval(); l.MinInterval > 0 && interval < l.MinInterval {
+		errs = append(errs, field.Invalid(path.Child("interval"), interval.String(), fmt.Sprintf("must be at least %s", l.MinInterval)))
+	}
+
+	if timeout := spec.GetTimeout(); l.MaxTimeout > 0 && timeout > l.MaxTimeout {
+		errs = append(errs, field.Invalid(path.Child("timeout"), timeout.String(), fmt.Sprintf("must be at most %s", l.MaxTimeout)))
+	}
+
+	return errs
+}
+
+// Clamp sets the interval and timeout of the spec to the limits, where it is outside of them
+func (l Limits) Clamp(spec *v2.NetworktestSpec) {
+	if l.MinInterval > 0 && spec.GetInterval() < l.MinInterval {
+		spec.Interval = &metav1.Duration{Duration: l.MinInterval}
+	}
+
+	if l.MaxTimeout > 0 && spec.GetTimeout() > l.MaxTimeout {
+		spec.Timeout = &metav1.Duration{Duration: l.MaxTimeout}
+	}
+}
@@ -0,0 +1,61 @@
+package testers
+
+import (
+	"edgeworks.no/networktester/api/v2"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func intervalSpec(interval time.Duration, timeout time.Duration) v2.NetworktestSpec {
+	return v2.NetworktestSpec{
+		Interval: &metav1.Duration{Duration: interval},
+		Timeout:  &metav1.Duration{Duration: timeout},
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MinInterval: 10 * time.Second, MaxTimeout: 30 * time.Second}
+
+	if errs := limits.Check(intervalSpec(time.Minute, 5*time.Second)); len(errs) != 0 {
+		t.Errorf("Check() within the limits = %v", errs)
+	}
+	if errs := limits.Check(intervalSpec(10*time.Second, 30*time.Second)); len(errs) != 0 {
+		t.Errorf("Check() at the limits = %v", errs)
+	}
+	if errs := limits.Check(v2.NetworktestSpec{}); len(errs) != 0 {
+		t.Errorf("Check() of the defaults = %v", errs)
+	}
+
+	errs := limits.Check(intervalSpec(time.Second, time.Minute))
+	if len(errs) != 2 || errs[0].Field != "spec.interval" || errs[1].Field != "spec.timeout" {
+		t.Errorf("Check() outside the limits = %v, want errors for spec.interval and spec.timeout", errs)
+	}
+
+	if errs := (Limits{}).Check(intervalSpec(time.Millisecond, time.Hour)); len(errs) != 0 {
+		t.Errorf("Check() without limits = %v", errs)
+	}
+}
+
+func TestLimitsClamp(t *testing.T) {
+	limits := Limits{MinInterval: 10 * time.Second, MaxTimeout: 30 * time.Second}
+
+	s := intervalSpec(time.Millisecond, time.Hour)
+	limits.Clamp(&s)
+	if s.GetInterval() != 10*time.Second || s.GetTimeout() != 30*time.Second {
+		t.Errorf("Clamp() set interval %s and timeout %s, want the limits", s.GetInterval(), s.GetTimeout())
+	}
+
+	s = intervalSpec(time.Minute, 5*time.Second)
+	limits.Clamp(&s)
+	if s.GetInterval() != time.Minute || s.GetTimeout() != 5*time.Second {
+		t.Errorf("Clamp() within the limits changed interval to %s and timeout to %s", s.GetInterval(), s.GetTimeout())
+	}
+
+	s = intervalSpec(time.Millisecond, time.Hour)
+	Limits{}.Clamp(&s)
+	if s.GetInterval() != time.Millisecond || s.GetTimeout() != time.Hour {
+		t.Errorf("Clamp() without limits changed interval to %s and timeout to %s", s.GetInterval(), s.GetTimeout())
+	}
+}
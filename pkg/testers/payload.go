@@ -0,0 +1,32 @@
+package testers
+
+import (
+	"edgeworks.no/networktester/api/v2"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// decodePayload returns the bytes of a payload written in the given encoding. Whitespace is allowed between the bytes
+// of hex encoded payloads, e.g. "de ad be ef".
+func decodePayload(payload string, encoding string) ([]byte, error) {
+	switch encoding {
+	case v2.EncodingText, "":
+		return []byte(payload), nil
+	case v2.EncodingHex:
+		data, err := hex.DecodeString(strings.Join(strings.Fields(payload), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex payload: %v", err)
+		}
+		return data, nil
+	case v2.EncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", encoding)
+	}
+}
@@ -0,0 +1,45 @@
+package testers
+
+import (
+	"bytes"
+	"edgeworks.no/networktester/api/v2"
+	"testing"
+)
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		payload  string
+		encoding string
+		want     []byte
+		err      bool
+	}{
+		{payload: "PING\r\n", encoding: v2.EncodingText, want: []byte("PING\r\n")},
+		{payload: "PING", encoding: "", want: []byte("PING")},
+		{payload: "", encoding: v2.EncodingText, want: []byte{}},
+		{payload: "deadbeef", encoding: v2.EncodingHex, want: []byte{0xde, 0xad, 0xbe, 0xef}},
+		{payload: "de ad\nbe\tEF", encoding: v2.EncodingHex, want: []byte{0xde, 0xad, 0xbe, 0xef}},
+		{payload: "", encoding: v2.EncodingHex, want: []byte{}},
+		{payload: "dea", encoding: v2.EncodingHex, err: true},
+		{payload: "zz", encoding: v2.EncodingHex, err: true},
+		{payload: "UElORw==", encoding: v2.EncodingBase64, want: []byte("PING")},
+		{payload: "UElORw", encoding: v2.EncodingBase64, err: true},
+		{payload: "PING", encoding: "rot13", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := decodePayload(tt.payload, tt.encoding)
+		if tt.err {
+			if err == nil {
+				t.Errorf("decodePayload(%q, %q) = %q, want error", tt.payload, tt.encoding, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodePayload(%q, %q) failed: %v", tt.payload, tt.encoding, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("decodePayload(%q, %q) = %q, want %q", tt.payload, tt.encoding, got, tt.want)
+		}
+	}
+}
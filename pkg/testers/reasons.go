@@ -0,0 +1,77 @@
+package testers
+
+import (
+	"context"
+	"crypto/tls"
+	"edgeworks.no/networktester/api/v2"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// FailureReason classifies why a probe failed, so failures can be aggregated across tests
+type FailureReason string
+
+const (
+	FailureTimeout     FailureReason = "timeout"
+	FailureRefused     FailureReason = "refused"
+	FailureReset       FailureReason = "reset"
+	FailureUnreachable FailureReason = "unreachable"
+	FailureDNSError    FailureReason = "dns_error"
+	FailureTLSError    FailureReason = "tls_error"
+	FailureHTTPStatus  FailureReason = "http_status"
+	FailureAssertion   FailureReason = "assertion"
+	FailureConfig      FailureReason = "config"
+	FailureOther       FailureReason = "other"
+)
+
+// classifyError returns the failure reason for an error returned when connecting to or talking with the target
+func classifyError(err error) FailureReason {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FailureTimeout
+	case errors.As(err, &dnsErr):
+		return FailureDNSError
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return FailureReset
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return FailureUnreachable
+	case isTLSVerificationError(err), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return FailureTLSError
+	default:
+		return FailureOther
+	}
+}
+
+// classifyOutcome returns how a connection attempt failing with the error ended. An attempt timing out without an
+// answer means the traffic was dropped on the way, which firewalls and network policies usually do. Empty when the
+// attempt ended otherwise, like a failed name lookup.
+func classifyOutcome(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return ""
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return v2.OutcomeRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return v2.OutcomeReset
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return v2.OutcomeHostUnreachable
+	case errors.Is(err, syscall.ENETUNREACH):
+		return v2.OutcomeNetworkUnreachable
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return v2.OutcomeFiltered
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,76 @@
+package testers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"edgeworks.no/networktester/api/v2"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// dialError wraps the error like a failed dial
+func dialError(err error) error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want FailureReason
+	}{
+		{name: "deadline", err: fmt.Errorf("request: %w", context.DeadlineExceeded), want: FailureTimeout},
+		{name: "i/o timeout", err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, want: FailureTimeout},
+		{name: "dns", err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}, want: FailureDNSError},
+		{name: "refused", err: dialError(syscall.ECONNREFUSED), want: FailureRefused},
+		{name: "reset", err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: FailureReset},
+		{name: "broken pipe", err: &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, want: FailureReset},
+		{name: "eof", err: fmt.Errorf("read response: %w", io.EOF), want: FailureReset},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: FailureReset},
+		{name: "host unreachable", err: dialError(syscall.EHOSTUNREACH), want: FailureUnreachable},
+		{name: "network unreachable", err: dialError(syscall.ENETUNREACH), want: FailureUnreachable},
+		{name: "unknown authority", err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, want: FailureTLSError},
+		{name: "hostname", err: fmt.Errorf("handshake: %w", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"}), want: FailureTLSError},
+		{name: "record header", err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, want: FailureTLSError},
+		{name: "alert", err: &net.OpError{Op: "remote error", Err: tls.AlertError(40)}, want: FailureTLSError},
+		{name: "other", err: errors.New("something else"), want: FailureOther},
+	}
+
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("%s: classifyError(%v) = %s, want %s", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyOutcome(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "refused", err: dialError(syscall.ECONNREFUSED), want: v2.OutcomeRefused},
+		{name: "reset", err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: v2.OutcomeReset},
+		{name: "eof", err: io.EOF, want: v2.OutcomeReset},
+		{name: "host unreachable", err: dialError(syscall.EHOSTUNREACH), want: v2.OutcomeHostUnreachable},
+		{name: "network unreachable", err: dialError(syscall.ENETUNREACH), want: v2.OutcomeNetworkUnreachable},
+		{name: "deadline", err: fmt.Errorf("dial: %w", context.DeadlineExceeded), want: v2.OutcomeFiltered},
+		{name: "i/o timeout", err: &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, want: v2.OutcomeFiltered},
+		// A lookup timing out says nothing about the traffic to the target
+		{name: "dns timeout", err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, want: ""},
+		{name: "dns", err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, want: ""},
+		{name: "other", err: errors.New("something else"), want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := classifyOutcome(tt.err); got != tt.want {
+			t.Errorf("%s: classifyOutcome(%v) = %q, want %q", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -3,97 +3,207 @@ package testers
 import (
 	"context"
 	"crypto/tls"
-	"edgeworks.no/networktester/api/v1"
+	"crypto/x509"
+	"edgeworks.no/networktester/api/v2"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
 	"time"
 )
 
-func PerformTest(t *v1.Networktest) (TestResult, error) {
+// TLSMaterial holds certificates loaded from Secrets and ConfigMaps referenced by a test
+type TLSMaterial struct {
+	// RootCAs to verify servers against. Nil means the system roots.
+	RootCAs *x509.CertPool
 
+	// ClientCertificate to present for client authentication, if any
+	ClientCertificate *tls.Certificate
+}
+
+func PerformTest(spec *v2.NetworktestSpec, tlsMaterial *TLSMaterial) (TestResult, error) {
+	if tlsMaterial == nil {
+		tlsMaterial = &TLSMaterial{}
+	}
+
+	var result TestResult
+	start := time.Now()
 	switch {
-	case t.Spec.Http != nil:
-		return doHttpTest(t), nil
-	case t.Spec.TCP != nil:
-		return doTCPTest(t), nil
+	case spec.HTTP != nil:
+		result = doHttpTest(spec, tlsMaterial)
+	case spec.TCP != nil:
+		result = doTCPTest(spec)
+	case spec.DNS != nil:
+		result = doDNSTest(spec)
+	case spec.TLS != nil:
+		result = doTLSTest(spec, tlsMaterial)
+	case spec.UDP != nil:
+		result = doUDPTest(spec)
+	case spec.ICMP != nil:
+		result = doICMPTest(spec)
+	case spec.GRPC != nil:
+		result = doGRPCTest(spec, tlsMaterial)
 	default:
 		return TestResult{}, fmt.Errorf("unknown probe type")
 	}
+	result.Timings.Total = time.Since(start)
+	if !result.Success && result.Reason == "" {
+		result.Reason = FailureOther
+	}
+
+	return applyExpectedOutcome(spec.GetExpectedOutcome(), result), nil
+}
+
+// blockingReasons are the failure reasons of results where the traffic was stopped on the way to the target
+var blockingReasons = []FailureReason{FailureTimeout, FailureRefused, FailureReset, FailureUnreachable}
+
+// applyExpectedOutcome inverts the result when traffic is expected to be blocked. Only results where
+// the traffic was stopped on the way count as success, so assertion failures on a reachable target
+// and failures before anything was sent, like a failed name lookup, are still reported as failures.
+// When a particular blocked outcome is expected, only that outcome counts as success.
+func applyExpectedOutcome(expected string, result TestResult) TestResult {
+	if expected != v2.OutcomeBlocked && !slices.Contains(v2.BlockedOutcomes, expected) {
+		return result
+	}
+
+	if result.Connected || result.Success {
+		result.Success = false
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("expected %s, but traffic got through: %s", expected, result.Message)
+		return result
+	}
+
+	if expected != v2.OutcomeBlocked && result.Outcome != expected {
+		outcome := result.Outcome
+		if outcome == "" {
+			outcome = "unknown"
+		}
+		result.Success = false
+		result.Reason = FailureAssertion
+		result.Message = fmt.Sprintf("expected %s, but the outcome was %s: %s", expected, outcome, result.Message)
+		return result
+	}
+
+	if expected == v2.OutcomeBlocked && !slices.Contains(blockingReasons, result.Reason) {
+		result.Message = fmt.Sprintf("expected %s, but the test failed before traffic was blocked: %s", expected, result.Message)
+		return result
+	}
+
+	result.Success = true
+	result.Reason = ""
+	result.Message = fmt.Sprintf("expected %s, traffic was blocked: %s", expected, result.Message)
+	return result
 }
 
-func doTCPTest(t *v1.Networktest) TestResult {
-	timeout, _ := time.ParseDuration(fmt.Sprintf("%ds", t.Spec.Timeout))
+func doTCPTest(spec *v2.NetworktestSpec) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
+	defer cancelFunc()
 
-	ip := t.Spec.TCP.Address
-	port := t.Spec.TCP.Port
+	var timings Timings
+	defer func() {
+		result.Timings = timings
+	}()
 
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, port), timeout)
+	conn, err := dialTimed(ctx, "tcp", spec.TCP.Address, spec.TCP.Port, &timings)
 	if err != nil {
 
 		if ne, ok := err.(net.Error); ok && ne.Timeout() {
 			return TestResult{
 				Success: false,
+				Reason:  FailureTimeout,
 				Message: fmt.Errorf("timeout: %v", err).Error(),
+				Outcome: v2.OutcomeFiltered,
 			}
 		}
 
 		return TestResult{
 			Success: false,
+			Reason:  classifyError(err),
 			Message: err.Error(),
+			Outcome: classifyOutcome(err),
 		}
 	}
 
 	defer conn.Close()
 
-	if t.Spec.TCP.Data == "" {
-		return TestResult{
-			Success: true,
-			Message: conn.RemoteAddr().String(),
+	// Firewalls accepting connections on behalf of the target may reset them once data is written
+	if spec.TCP.Data != "" {
+		num, err := conn.Write([]byte(spec.TCP.Data))
+		if err != nil {
+			return TestResult{
+				Success: false,
+				Reason:  classifyError(err),
+				Message: fmt.Errorf("Failed to write data: %v", err).Error(),
+				Outcome: classifyOutcome(err),
+			}
 		}
-	}
 
-	num, err := conn.Write([]byte(t.Spec.TCP.Data))
-	if err != nil {
-		return TestResult{
-			Success: false,
-			Message: fmt.Errorf("Failed to write data: %v", err).Error(),
+		dataLen := len([]byte(spec.TCP.Data))
+		if num != dataLen {
+			return TestResult{
+				Success: false,
+				Reason:  FailureOther,
+				Message: fmt.Errorf("failed to write data: %d != %d", num, dataLen).Error(),
+			}
 		}
 	}
 
-	dataLen := len([]byte(t.Spec.TCP.Data))
-	if num != dataLen {
-		return TestResult{
-			Success: false,
-			Message: fmt.Errorf("failed to write data: %d != %d", num, dataLen).Error(),
-		}
+	if len(spec.TCP.Steps) > 0 {
+		return converse(ctx, conn, spec.TCP.Steps, &timings)
 	}
 
 	return TestResult{
-		Success: true,
-		Message: conn.RemoteAddr().String(),
+		Success:   true,
+		Connected: true,
+		Message:   conn.RemoteAddr().String(),
+		Outcome:   v2.OutcomeConnected,
 	}
 }
 
-func doHttpTest(t *v1.Networktest) TestResult {
-	timeout, _ := time.ParseDuration(fmt.Sprintf("%ds", t.Spec.Timeout))
-	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+func doHttpTest(spec *v2.NetworktestSpec, tlsMaterial *TLSMaterial) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
 	defer cancelFunc()
 
-	r, err := http.NewRequestWithContext(ctx, http.MethodGet, t.Spec.Http.URL, nil)
+	trace := newHTTPTrace()
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	defer func() {
+		result.Timings = trace.result()
+	}()
+
+	var body io.Reader
+	if spec.HTTP.RequestBody != "" {
+		body = strings.NewReader(spec.HTTP.RequestBody)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, spec.HTTP.GetMethod(), spec.HTTP.URL, body)
 	if err != nil {
 		return TestResult{
 			Success: false,
+			Reason:  FailureConfig,
 			Message: err.Error(),
 		}
 	}
 
-	tr := &http.Transport{}
-	if t.Spec.Http.TlsSkipVerify {
-		tr.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
+	for _, h := range spec.HTTP.Headers {
+		r.Header.Add(h.Name, h.Value)
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: spec.HTTP.TLSSkipVerify,
+			RootCAs:            tlsMaterial.RootCAs,
+		},
+	}
+	if tlsMaterial.ClientCertificate != nil {
+		tr.TLSClientConfig.Certificates = []tls.Certificate{*tlsMaterial.ClientCertificate}
+	}
+	if spec.HTTP.Host != "" {
+		r.Host = spec.HTTP.Host
+		tr.TLSClientConfig.ServerName = hostname(spec.HTTP.Host)
 	}
 	c := http.Client{Transport: tr}
 
@@ -103,27 +213,93 @@ func doHttpTest(t *v1.Networktest) TestResult {
 		if errors.Is(err, context.DeadlineExceeded) {
 			return TestResult{
 				Success: false,
+				Reason:  FailureTimeout,
 				Message: fmt.Errorf("timeout: %v", err).Error(),
 			}
 		}
 
 		return TestResult{
-			Success: false,
-			Message: err.Error(),
+			Success:   false,
+			Reason:    classifyError(err),
+			Connected: isTLSVerificationError(err),
+			Message:   err.Error(),
 		}
 	}
 
-	if matchesCode(res.StatusCode, t.Spec.Http.FailOnCodes) {
+	defer res.Body.Close()
+
+	if matchesCode(res.StatusCode, spec.HTTP.FailOnCodes) {
 		return TestResult{
-			Success: false,
-			Message: fmt.Sprintf("http result: %s matches failOnCodes", res.Status),
+			Success:   false,
+			Reason:    FailureHTTPStatus,
+			Connected: true,
+			Message:   fmt.Sprintf("http result: %s matches failOnCodes", res.Status),
+		}
+	}
+
+	if len(spec.HTTP.ExpectCodes) > 0 {
+		ranges, err := parseCodeRanges(spec.HTTP.ExpectCodes)
+		if err != nil {
+			return TestResult{
+				Success:   false,
+				Reason:    FailureConfig,
+				Connected: true,
+				Message:   fmt.Sprintf("http result: %s: %v", res.Status, err),
+			}
+		}
+		if !inCodeRanges(res.StatusCode, ranges) {
+			return TestResult{
+				Success:   false,
+				Reason:    FailureHTTPStatus,
+				Connected: true,
+				Message:   fmt.Sprintf("http result: %s does not match expectCodes %s", res.Status, strings.Join(spec.HTTP.ExpectCodes, ",")),
+			}
+		}
+	}
+
+	if spec.HTTP.Body != nil {
+		failure, err := checkBody(res.Body, spec.HTTP.Body)
+		if err != nil {
+			return TestResult{
+				Success:   false,
+				Reason:    classifyError(err),
+				Connected: true,
+				Message:   fmt.Sprintf("http result: %s: %v", res.Status, err),
+			}
+		}
+		if failure != "" {
+			return TestResult{
+				Success:   false,
+				Reason:    FailureAssertion,
+				Connected: true,
+				Message:   fmt.Sprintf("http result: %s: %s", res.Status, failure),
+			}
 		}
 	}
 
 	return TestResult{
-		Success: true,
-		Message: fmt.Sprintf("http result: %s", res.Status),
+		Success:   true,
+		Connected: true,
+		Message:   fmt.Sprintf("http result: %s", res.Status),
+	}
+}
+
+// isTLSVerificationError checks if the request failed on verifying the server certificate, which
+// means a connection was established with the server.
+func isTLSVerificationError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &authErr) || errors.As(err, &invalidErr)
+}
+
+// hostname strips the port from a Host header value
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
 	}
+	return host
 }
 
 func matchesCode(actualCode int, matchesCodes []int) bool {
@@ -138,6 +314,25 @@ func matchesCode(actualCode int, matchesCodes []int) bool {
 type TestResult struct {
 	Success bool
 	Message string
+
+	// Reason classifies why the test failed. Empty when it succeeded.
+	Reason FailureReason
+
+	// Connected is true when traffic reached the target, even if the test itself failed
+	Connected bool
+
+	// Outcome is how the connection attempt of a TCP probe ended, one of the outcomes in the v2 API. Empty for other
+	// probes, or when the attempt ended otherwise, like a failed name lookup.
+	Outcome string
+
+	// CertificateExpiry is the expiry time of the server certificate, for tests inspecting certificates
+	CertificateExpiry *time.Time
+
+	// Ping holds the packet loss and round trip times, for ICMP tests
+	Ping *PingStats
+
+	// Timings of each phase of the probe
+	Timings Timings
 }
 
 const (
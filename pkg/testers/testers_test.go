@@ -0,0 +1,95 @@
+package testers
+
+import (
+	"edgeworks.no/networktester/api/v2"
+	"strings"
+	"testing"
+)
+
+var (
+	refused   = TestResult{Success: false, Reason: FailureRefused, Message: "connection refused", Outcome: v2.OutcomeRefused}
+	connected = TestResult{Success: true, Connected: true, Message: "10.0.0.1:443", Outcome: v2.OutcomeConnected}
+	rejected  = TestResult{Success: false, Reason: FailureHTTPStatus, Connected: true, Message: "http result: 403 Forbidden"}
+)
+
+func TestExpectAllowed(t *testing.T) {
+	for _, expected := range []string{"", v2.OutcomeAllowed} {
+		if got := applyExpectedOutcome(expected, connected); got != connected {
+			t.Errorf("applyExpectedOutcome(%q) of a connection = %+v, want it unchanged", expected, got)
+		}
+		if got := applyExpectedOutcome(expected, refused); got != refused {
+			t.Errorf("applyExpectedOutcome(%q) of a refused connection = %+v, want it unchanged", expected, got)
+		}
+	}
+}
+
+func TestExpectBlocked(t *testing.T) {
+	got := applyExpectedOutcome(v2.OutcomeBlocked, refused)
+	if !got.Success || got.Reason != "" || got.Message != "expected Blocked, traffic was blocked: connection refused" {
+		t.Errorf("applyExpectedOutcome() of a refused connection = %+v, want success", got)
+	}
+
+	got = applyExpectedOutcome(v2.OutcomeBlocked, connected)
+	if got.Success || !got.Connected || got.Reason != FailureAssertion || got.Message != "expected Blocked, but traffic got through: 10.0.0.1:443" {
+		t.Errorf("applyExpectedOutcome() of a connection = %+v, want failure", got)
+	}
+
+	got = applyExpectedOutcome(v2.OutcomeBlocked, TestResult{Reason: FailureUnreachable, Message: "no route to host"})
+	if !got.Success || got.Reason != "" {
+		t.Errorf("applyExpectedOutcome() of an unreachable host = %+v, want success", got)
+	}
+
+	// The target answered, so the traffic was not blocked even though the test failed
+	got = applyExpectedOutcome(v2.OutcomeBlocked, rejected)
+	if got.Success || got.Reason != FailureAssertion || got.Message != "expected Blocked, but traffic got through: http result: 403 Forbidden" {
+		t.Errorf("applyExpectedOutcome() of a rejected request = %+v, want failure", got)
+	}
+}
+
+func TestExpectBlockedFailedBeforeSending(t *testing.T) {
+	// Failing before anything is sent says nothing about whether the traffic would have been blocked
+	got := applyExpectedOutcome(v2.OutcomeBlocked, TestResult{Reason: FailureDNSError, Message: "lookup db.example.com: no such host"})
+	if got.Success || got.Reason != FailureDNSError || got.Message != "expected Blocked, but the test failed before traffic was blocked: lookup db.example.com: no such host" {
+		t.Errorf("applyExpectedOutcome() of a failed lookup = %+v, want failure", got)
+	}
+
+	got = applyExpectedOutcome(v2.OutcomeBlocked, TestResult{Reason: FailureConfig, Message: "invalid payload"})
+	if got.Success || got.Reason != FailureConfig {
+		t.Errorf("applyExpectedOutcome() of an invalid configuration = %+v, want failure", got)
+	}
+
+	got = applyExpectedOutcome(v2.OutcomeBlocked, TestResult{Reason: FailureTLSError, Message: "certificate signed by unknown authority"})
+	if got.Success || got.Reason != FailureTLSError {
+		t.Errorf("applyExpectedOutcome() of a TLS error = %+v, want failure", got)
+	}
+
+	// A probe succeeding without a connection, like a ping being answered, still got through
+	got = applyExpectedOutcome(v2.OutcomeBlocked, TestResult{Success: true, Message: "3/3 packets received"})
+	if got.Success || got.Reason != FailureAssertion {
+		t.Errorf("applyExpectedOutcome() of a successful probe = %+v, want failure", got)
+	}
+}
+
+func TestExpectBlockedOutcome(t *testing.T) {
+	got := applyExpectedOutcome(v2.OutcomeRefused, refused)
+	if !got.Success || got.Message != "expected Refused, traffic was blocked: connection refused" {
+		t.Errorf("applyExpectedOutcome() of the expected outcome = %+v, want success", got)
+	}
+
+	// Blocked in another way than expected
+	got = applyExpectedOutcome(v2.OutcomeFiltered, refused)
+	if got.Success || got.Reason != FailureAssertion || got.Message != "expected Filtered, but the outcome was Refused: connection refused" {
+		t.Errorf("applyExpectedOutcome() of another outcome = %+v, want failure", got)
+	}
+
+	got = applyExpectedOutcome(v2.OutcomeRefused, connected)
+	if got.Success || got.Reason != FailureAssertion || !strings.HasPrefix(got.Message, "expected Refused, but traffic got through") {
+		t.Errorf("applyExpectedOutcome() of a connection = %+v, want failure", got)
+	}
+
+	// Failing before connecting says nothing about how the traffic would have been blocked
+	got = applyExpectedOutcome(v2.OutcomeRefused, TestResult{Reason: FailureDNSError, Message: "no such host"})
+	if got.Success || got.Reason != FailureAssertion || got.Message != "expected Refused, but the outcome was unknown: no such host" {
+		t.Errorf("applyExpectedOutcome() of a failed lookup = %+v, want failure", got)
+	}
+}
@@ -0,0 +1,105 @@
+package testers
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timings holds the duration of each phase of a probe. Phases not part of the probe are zero.
+type Timings struct {
+	Total        time.Duration
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+}
+
+// dialTimed connects to the host like net.Dialer, racing IPv6 and IPv4 addresses on dual-stack hosts, recording the
+// time spent on name lookup and connecting. The network is "tcp" or "udp".
+func dialTimed(ctx context.Context, network string, host string, port int, timings *Timings) (net.Conn, error) {
+	trace := newHTTPTrace()
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, net.JoinHostPort(host, strconv.Itoa(port)))
+
+	result := trace.result()
+	timings.DNSLookup = result.DNSLookup
+	timings.Connect = result.Connect
+	return conn, err
+}
+
+// httpTrace records phase timings of an HTTP request. Callbacks may be called concurrently
+// when several addresses are dialed in parallel.
+type httpTrace struct {
+	mu             sync.Mutex
+	start          time.Time
+	dnsStart       time.Time
+	connectStart   time.Time
+	handshakeStart time.Time
+	connected      bool
+	timings        Timings
+}
+
+func newHTTPTrace() *httpTrace {
+	return &httpTrace{start: time.Now()}
+}
+
+func (h *httpTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.timings.DNSLookup = time.Since(h.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.connectStart.IsZero() {
+				h.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			// A failed attempt only counts until an address accepts the connection
+			if err == nil || !h.connected {
+				h.timings.Connect = time.Since(h.connectStart)
+			}
+			if err == nil {
+				h.connected = true
+			}
+		},
+		TLSHandshakeStart: func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.handshakeStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.timings.TLSHandshake = time.Since(h.handshakeStart)
+		},
+		GotFirstResponseByte: func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.timings.FirstByte = time.Since(h.start)
+		},
+	}
+}
+
+func (h *httpTrace) result() Timings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.timings
+}
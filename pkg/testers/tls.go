@@ -0,0 +1,138 @@
+package testers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+func doTLSTest(spec *v2.NetworktestSpec, tlsMaterial *TLSMaterial) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
+	defer cancelFunc()
+
+	var timings Timings
+	defer func() {
+		result.Timings = timings
+	}()
+
+	serverName := spec.TLS.GetServerName()
+
+	// Verification is done after the handshake, so the certificate can be reported even when it is not valid
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	}
+	if tlsMaterial.ClientCertificate != nil {
+		config.Certificates = []tls.Certificate{*tlsMaterial.ClientCertificate}
+	}
+
+	conn, err := dialTLS(ctx, spec.TLS.Address, spec.TLS.GetPort(), config, &timings)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return TestResult{
+				Success: false,
+				Reason:  FailureTimeout,
+				Message: fmt.Errorf("timeout: %v", err).Error(),
+			}
+		}
+
+		return TestResult{
+			Success: false,
+			Reason:  classifyError(err),
+			Message: err.Error(),
+		}
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return TestResult{
+			Success:   false,
+			Reason:    FailureTLSError,
+			Connected: true,
+			Message:   "no certificate presented by server",
+		}
+	}
+	leaf := certs[0]
+
+	// Certificate verification failures take precedence over failed assertions in the reason
+	var problems []string
+	reason := FailureAssertion
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	chain := "chain valid"
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: tlsMaterial.RootCAs, Intermediates: intermediates}); err != nil {
+		chain = "chain invalid"
+		problems = append(problems, err.Error())
+		reason = FailureTLSError
+	}
+
+	if err := leaf.VerifyHostname(serverName); err != nil {
+		problems = append(problems, err.Error())
+		reason = FailureTLSError
+	}
+
+	daysLeft := int(time.Until(leaf.NotAfter).Hours() / 24)
+	if minDays := spec.TLS.GetMinDaysUntilExpiry(); daysLeft < minDays {
+		problems = append(problems, fmt.Sprintf("certificate expires in %d days, minimum is %d", daysLeft, minDays))
+	}
+
+	if spec.TLS.ExpectedIssuer != "" && !strings.Contains(leaf.Issuer.String(), spec.TLS.ExpectedIssuer) {
+		problems = append(problems, fmt.Sprintf("issuer does not contain %q", spec.TLS.ExpectedIssuer))
+	}
+
+	expiry := leaf.NotAfter
+	details := fmt.Sprintf("subject %s, SANs [%s], issuer %s, %s, expires in %d days (%s)",
+		leaf.Subject, strings.Join(subjectAltNames(leaf), ", "), leaf.Issuer, chain, daysLeft, expiry.Format(time.RFC3339))
+
+	if len(problems) > 0 {
+		return TestResult{
+			Success:           false,
+			Reason:            reason,
+			Connected:         true,
+			Message:           fmt.Sprintf("%s: %s", strings.Join(problems, "; "), details),
+			CertificateExpiry: &expiry,
+		}
+	}
+
+	return TestResult{
+		Success:           true,
+		Connected:         true,
+		Message:           details,
+		CertificateExpiry: &expiry,
+	}
+}
+
+// dialTLS connects and performs the TLS handshake, recording the time spent on each phase
+func dialTLS(ctx context.Context, host string, port int, config *tls.Config, timings *Timings) (*tls.Conn, error) {
+	raw, err := dialTimed(ctx, "tcp", host, port, timings)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	conn := tls.Client(raw, config)
+	err = conn.HandshakeContext(ctx)
+	timings.TLSHandshake = time.Since(start)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func subjectAltNames(c *x509.Certificate) []string {
+	names := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
@@ -0,0 +1,222 @@
+package testers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"edgeworks.no/networktester/api/v2"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testCA signs the certificates of the TLS servers started by the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Networktester Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// certificate returns a certificate for 127.0.0.1 and localhost expiring after validFor
+func (ca *testCA) certificate(t *testing.T, validFor time.Duration) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serve starts a TLS server with a certificate expiring after validFor, and returns its port
+func (ca *testCA) serve(t *testing.T, validFor time.Duration) int {
+	t.Helper()
+
+	// The probes close the connection after the handshake, which the server would log
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{ca.certificate(t, validFor)}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// tlsSpec returns the spec of a test of the probe on a loopback port
+func tlsSpec(port int, probe v2.TLSProbe) *v2.NetworktestSpec {
+	probe.Address = "127.0.0.1"
+	probe.Port = port
+	return &v2.NetworktestSpec{Timeout: &metav1.Duration{Duration: 2 * time.Second}, TLS: &probe}
+}
+
+func TestTLSProbe(t *testing.T) {
+	ca := newTestCA(t)
+	valid := ca.serve(t, 90*24*time.Hour)
+	expiring := ca.serve(t, 7*24*time.Hour)
+	noMinimum := 0
+
+	tests := []struct {
+		name      string
+		port      int
+		probe     v2.TLSProbe
+		untrusted bool
+		success   bool
+		reason    FailureReason
+		message   string
+	}{
+		{
+			name:    "valid certificate",
+			port:    valid,
+			probe:   v2.TLSProbe{ExpectedIssuer: "Networktester Test CA"},
+			success: true,
+			message: "chain valid, expires in 89 days",
+		},
+		{
+			name:    "server name",
+			port:    valid,
+			probe:   v2.TLSProbe{ServerName: "localhost"},
+			success: true,
+			message: "SANs [localhost, 127.0.0.1]",
+		},
+		{
+			name:    "expires within the minimum days",
+			port:    expiring,
+			reason:  FailureAssertion,
+			message: "certificate expires in 6 days, minimum is 14",
+		},
+		{
+			name:    "without minimum days",
+			port:    expiring,
+			probe:   v2.TLSProbe{MinDaysUntilExpiry: &noMinimum},
+			success: true,
+			message: "chain valid, expires in 6 days",
+		},
+		{
+			name:    "hostname mismatch",
+			port:    valid,
+			probe:   v2.TLSProbe{ServerName: "example.com"},
+			reason:  FailureTLSError,
+			message: "certificate is valid for localhost, not example.com",
+		},
+		{
+			name:    "unexpected issuer",
+			port:    valid,
+			probe:   v2.TLSProbe{ExpectedIssuer: "Let's Encrypt"},
+			reason:  FailureAssertion,
+			message: `issuer does not contain "Let's Encrypt"`,
+		},
+		{
+			// The certificate is reported even when the chain can not be verified
+			name:      "unknown authority",
+			port:      valid,
+			untrusted: true,
+			reason:    FailureTLSError,
+			message:   "chain invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			material := &TLSMaterial{RootCAs: ca.pool}
+			if tt.untrusted {
+				material = &TLSMaterial{}
+			}
+
+			result := doTLSTest(tlsSpec(tt.port, tt.probe), material)
+			if result.Success != tt.success || result.Reason != tt.reason || !result.Connected {
+				t.Errorf("doTLSTest() = %+v, want success %v and reason %q", result, tt.success, tt.reason)
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("doTLSTest() message = %q, want it to contain %q", result.Message, tt.message)
+			}
+			if result.CertificateExpiry == nil {
+				t.Errorf("doTLSTest() did not report the certificate expiry")
+			}
+			if result.Timings.Connect == 0 || result.Timings.TLSHandshake == 0 {
+				t.Errorf("doTLSTest() timings = %+v, want connect and handshake", result.Timings)
+			}
+		})
+	}
+}
+
+func TestTLSProbeCertificateExpiry(t *testing.T) {
+	ca := newTestCA(t)
+	port := ca.serve(t, 30*24*time.Hour)
+
+	result := doTLSTest(tlsSpec(port, v2.TLSProbe{}), &TLSMaterial{RootCAs: ca.pool})
+	if !result.Success {
+		t.Fatalf("doTLSTest() failed: %s", result.Message)
+	}
+
+	// Certificates keep their validity in whole seconds
+	want := time.Now().Add(30 * 24 * time.Hour)
+	if d := want.Sub(*result.CertificateExpiry); d < 0 || d > time.Minute {
+		t.Errorf("doTLSTest() reported expiry %s, want %s", result.CertificateExpiry, want)
+	}
+}
+
+func TestTLSProbeNotListening(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	result := doTLSTest(tlsSpec(port, v2.TLSProbe{}), &TLSMaterial{})
+	if result.Success || result.Connected || result.Reason != FailureRefused || result.CertificateExpiry != nil {
+		t.Errorf("doTLSTest() = %+v, want a refused connection without a certificate", result)
+	}
+}
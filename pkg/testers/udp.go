@@ -0,0 +1,110 @@
+package testers
+
+import (
+	"context"
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// maxDatagramSize is the largest UDP payload, so a response is never truncated
+const maxDatagramSize = 65535
+
+func doUDPTest(spec *v2.NetworktestSpec) (result TestResult) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), spec.GetTimeout())
+	defer cancelFunc()
+
+	var timings Timings
+	defer func() {
+		result.Timings = timings
+	}()
+
+	p := spec.UDP
+	payload, err := decodePayload(p.Payload, p.GetEncoding())
+	if err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  FailureConfig,
+			Message: err.Error(),
+		}
+	}
+
+	var re *regexp.Regexp
+	if p.ExpectResponse != nil && p.ExpectResponse.Matches != "" {
+		if re, err = regexp.Compile(p.ExpectResponse.Matches); err != nil {
+			return TestResult{
+				Success: false,
+				Reason:  FailureConfig,
+				Message: fmt.Errorf("invalid regular expression: %v", err).Error(),
+			}
+		}
+	}
+
+	conn, err := dialTimed(ctx, "udp", p.Address, p.Port, &timings)
+	if err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  classifyError(err),
+			Message: err.Error(),
+		}
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(payload); err != nil {
+		return TestResult{
+			Success: false,
+			Reason:  classifyError(err),
+			Message: fmt.Errorf("failed to send datagram: %v", err).Error(),
+		}
+	}
+
+	if p.ExpectResponse == nil {
+		return TestResult{
+			Success:   true,
+			Connected: true,
+			Message:   fmt.Sprintf("sent %d bytes to %s", len(payload), conn.RemoteAddr()),
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	start := time.Now()
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		// No response may as well be a firewall dropping the datagram as a service not answering
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return TestResult{
+				Success: false,
+				Reason:  FailureTimeout,
+				Message: fmt.Errorf("no response: %v", err).Error(),
+			}
+		}
+		// A closed port is reported by an ICMP port unreachable, read as a refused connection
+		return TestResult{
+			Success: false,
+			Reason:  classifyError(err),
+			Message: fmt.Errorf("failed to read response: %v", err).Error(),
+		}
+	}
+	timings.FirstByte = time.Since(start)
+	response := buf[:n]
+
+	if re != nil && !re.Match(response) {
+		return TestResult{
+			Success:   false,
+			Reason:    FailureAssertion,
+			Connected: true,
+			Message:   fmt.Sprintf("response does not match %q: %q", p.ExpectResponse.Matches, excerpt(response)),
+		}
+	}
+
+	return TestResult{
+		Success:   true,
+		Connected: true,
+		Message:   fmt.Sprintf("%s responded with %d bytes", conn.RemoteAddr(), n),
+	}
+}
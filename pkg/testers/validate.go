@@ -0,0 +1,248 @@
+package testers
+
+import (
+	"edgeworks.no/networktester/api/v2"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateSpec checks that a test can be performed as specified. It is used both by the admission webhook, to reject
+// invalid tests at apply time, and by the controller before activating a test.
+func ValidateSpec(spec v2.NetworktestSpec) field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+
+	if spec.Interval != nil && spec.Interval.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), spec.Interval.Duration.String(), "must be greater than zero"))
+	}
+
+	if spec.Timeout != nil && spec.Timeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("timeout"), spec.Timeout.Duration.String(), "must be greater than zero"))
+	}
+
+	if spec.RetryDelay != nil && spec.RetryDelay.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("retryDelay"), spec.RetryDelay.Duration.String(), "must not be negative"))
+	}
+
+	if spec.HistoryLimit < 0 {
+		errs = append(errs, field.Invalid(path.Child("historyLimit"), spec.HistoryLimit, "must not be negative"))
+	}
+
+	if slices.Contains(v2.BlockedOutcomes, spec.ExpectedOutcome) && spec.TCP == nil {
+		errs = append(errs, field.Invalid(path.Child("expectedOutcome"), spec.ExpectedOutcome, "only tcp probes can expect a particular blocked outcome, use Blocked"))
+	}
+
+	var probes []string
+	if spec.HTTP != nil {
+		probes = append(probes, "http")
+		errs = append(errs, validateHttp(spec.HTTP, path.Child("http"))...)
+	}
+	if spec.TCP != nil {
+		probes = append(probes, "tcp")
+		if spec.TCP.Address == "" {
+			errs = append(errs, field.Required(path.Child("tcp", "address"), "address to connect to is required"))
+		}
+		errs = append(errs, validatePort(spec.TCP.Port, path.Child("tcp", "port"))...)
+		errs = append(errs, validateTCPSteps(spec.TCP.Steps, path.Child("tcp", "steps"))...)
+	}
+	if spec.DNS != nil {
+		probes = append(probes, "dns")
+		if spec.DNS.Name == "" {
+			errs = append(errs, field.Required(path.Child("dns", "name"), "name to look up is required"))
+		}
+	}
+	if spec.TLS != nil {
+		probes = append(probes, "tls")
+		if spec.TLS.Address == "" {
+			errs = append(errs, field.Required(path.Child("tls", "address"), "address to connect to is required"))
+		}
+		// 0 means the default port
+		if spec.TLS.Port != 0 {
+			errs = append(errs, validatePort(spec.TLS.Port, path.Child("tls", "port"))...)
+		}
+	}
+
+	if spec.UDP != nil {
+		probes = append(probes, "udp")
+		errs = append(errs, validateUDP(spec.UDP, path.Child("udp"))...)
+	}
+
+	if spec.ICMP != nil {
+		probes = append(probes, "icmp")
+		errs = append(errs, validateICMP(spec.ICMP, spec.GetTimeout(), path.Child("icmp"))...)
+	}
+
+	if spec.GRPC != nil {
+		probes = append(probes, "grpc")
+		errs = append(errs, validateGRPC(spec.GRPC, path.Child("grpc"))...)
+	}
+
+	switch len(probes) {
+	case 0:
+		errs = append(errs, field.Required(path, "one of http, tcp, udp, icmp, grpc, dns or tls must be specified"))
+	case 1:
+	default:
+		errs = append(errs, field.Forbidden(path, fmt.Sprintf("only one of http, tcp, udp, icmp, grpc, dns or tls can be specified, got %s", strings.Join(probes, ", "))))
+	}
+
+	return errs
+}
+
+func validateHttp(h *v2.HTTPProbe, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	u, err := url.Parse(h.URL)
+	switch {
+	case h.URL == "":
+		errs = append(errs, field.Required(path.Child("url"), "url is required"))
+	case err != nil:
+		errs = append(errs, field.Invalid(path.Child("url"), h.URL, err.Error()))
+	case u.Scheme != "http" && u.Scheme != "https":
+		errs = append(errs, field.Invalid(path.Child("url"), h.URL, "scheme must be http or https"))
+	case u.Host == "":
+		errs = append(errs, field.Invalid(path.Child("url"), h.URL, "host is missing"))
+	}
+
+	for i, code := range h.FailOnCodes {
+		if code < 100 || code > 599 {
+			errs = append(errs, field.Invalid(path.Child("failOnCodes").Index(i), code, "must be an HTTP status code between 100 and 599"))
+		}
+	}
+
+	if err := ValidateExpectCodes(h.ExpectCodes); err != nil {
+		errs = append(errs, field.Invalid(path.Child("expectCodes"), h.ExpectCodes, err.Error()))
+	}
+
+	if err := ValidateHttpBody(h.Body); err != nil {
+		errs = append(errs, field.Invalid(path.Child("body"), h.Body, err.Error()))
+	}
+
+	errs = append(errs, validateHeaders(h.Headers, path.Child("headers"))...)
+
+	return errs
+}
+
+func validateHeaders(headers []v2.HTTPHeader, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for i, header := range headers {
+		if header.Name == "" {
+			errs = append(errs, field.Required(path.Index(i).Child("name"), "header name is required"))
+		}
+		if header.Value != "" && header.ValueFrom != nil {
+			errs = append(errs, field.Forbidden(path.Index(i), "only one of value and valueFrom can be specified"))
+		}
+	}
+
+	return errs
+}
+
+func validateGRPC(p *v2.GRPCProbe, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if p.Address == "" {
+		errs = append(errs, field.Required(path.Child("address"), "address to connect to is required"))
+	}
+	errs = append(errs, validatePort(p.Port, path.Child("port"))...)
+	errs = append(errs, validateHeaders(p.Metadata, path.Child("metadata"))...)
+
+	// Settings for TLS would silently be ignored on a plaintext connection
+	if !p.TLS {
+		if p.TLSSkipVerify {
+			errs = append(errs, field.Forbidden(path.Child("tlsSkipVerify"), "requires tls"))
+		}
+		if p.ServerName != "" {
+			errs = append(errs, field.Forbidden(path.Child("serverName"), "requires tls"))
+		}
+		if p.CABundle != nil {
+			errs = append(errs, field.Forbidden(path.Child("caBundle"), "requires tls"))
+		}
+		if p.ClientCertificateSecret != "" {
+			errs = append(errs, field.Forbidden(path.Child("clientCertificateSecret"), "requires tls"))
+		}
+	}
+
+	return errs
+}
+
+func validateUDP(p *v2.UDPProbe, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if p.Address == "" {
+		errs = append(errs, field.Required(path.Child("address"), "address to send to is required"))
+	}
+	errs = append(errs, validatePort(p.Port, path.Child("port"))...)
+
+	if _, err := decodePayload(p.Payload, p.GetEncoding()); err != nil {
+		errs = append(errs, field.Invalid(path.Child("payload"), p.Payload, err.Error()))
+	}
+
+	if p.ExpectResponse != nil && p.ExpectResponse.Matches != "" {
+		if _, err := regexp.Compile(p.ExpectResponse.Matches); err != nil {
+			errs = append(errs, field.Invalid(path.Child("expectResponse", "matches"), p.ExpectResponse.Matches, fmt.Sprintf("invalid regular expression: %v", err)))
+		}
+	}
+
+	return errs
+}
+
+func validateTCPSteps(steps []v2.TCPStep, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for i, step := range steps {
+		if step.Expect == "" && step.Send == "" {
+			errs = append(errs, field.Required(path.Index(i), "each step must have expect, send or both"))
+		}
+		if _, err := regexp.Compile(step.Expect); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i).Child("expect"), step.Expect, fmt.Sprintf("invalid regular expression: %v", err)))
+		}
+		if step.ReadTimeout != nil && step.ReadTimeout.Duration <= 0 {
+			errs = append(errs, field.Invalid(path.Index(i).Child("readTimeout"), step.ReadTimeout.Duration.String(), "must be greater than zero"))
+		}
+		if _, err := decodePayload(step.Send, step.GetEncoding()); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i).Child("send"), step.Send, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func validateICMP(p *v2.ICMPProbe, timeout time.Duration, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if p.Address == "" {
+		errs = append(errs, field.Required(path.Child("address"), "address to ping is required"))
+	}
+
+	if p.Count != 0 && (p.Count < 1 || p.Count > 100) {
+		errs = append(errs, field.Invalid(path.Child("count"), p.Count, "must be between 1 and 100"))
+	}
+
+	if p.PacketInterval != nil && p.PacketInterval.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("packetInterval"), p.PacketInterval.Duration.String(), "must be greater than zero"))
+	}
+
+	// All echo requests must be sent before the test times out, leaving time for the last reply
+	if sending := time.Duration(p.GetCount()-1) * p.GetPacketInterval(); sending >= timeout {
+		errs = append(errs, field.Invalid(path.Child("count"), p.GetCount(), fmt.Sprintf("sending %d echo requests %s apart takes longer than the timeout of %s", p.GetCount(), p.GetPacketInterval(), timeout)))
+	}
+
+	if p.MaxPacketLoss < 0 || p.MaxPacketLoss > 100 {
+		errs = append(errs, field.Invalid(path.Child("maxPacketLoss"), p.MaxPacketLoss, "must be between 0 and 100"))
+	}
+
+	return errs
+}
+
+func validatePort(port int, path *field.Path) field.ErrorList {
+	if port < 1 || port > 65535 {
+		return field.ErrorList{field.Invalid(path, port, "must be between 1 and 65535")}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"edgeworks.no/networktester/pkg/testers"
+	"fmt"
+	"net"
+	"strings"
+
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	edgeworksnov2 "edgeworks.no/networktester/api/v2"
+)
+
+//+kubebuilder:webhook:path=/mutate-edgeworks-no-v2-networktest,mutating=true,failurePolicy=fail,sideEffects=None,groups=edgeworks.no,resources=networktests,verbs=create;update,versions=v2,name=mnetworktest.edgeworks.no,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-edgeworks-no-v2-networktest,mutating=false,failurePolicy=fail,sideEffects=None,groups=edgeworks.no,resources=networktests,verbs=create;update,versions=v2,name=vnetworktest.edgeworks.no,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/mutate-edgeworks-no-v2-clusternetworktest,mutating=true,failurePolicy=fail,sideEffects=None,groups=edgeworks.no,resources=clusternetworktests,verbs=create;update,versions=v2,name=mclusternetworktest.edgeworks.no,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-edgeworks-no-v2-clusternetworktest,mutating=false,failurePolicy=fail,sideEffects=None,groups=edgeworks.no,resources=clusternetworktests,verbs=create;update,versions=v2,name=vclusternetworktest.edgeworks.no,admissionReviewVersions=v1
+
+// NetworktestDefaulter normalizes Networktests and ClusterNetworktests, so the stored spec shows the values actually used
+type NetworktestDefaulter struct{}
+
+var _ admission.CustomDefaulter = &NetworktestDefaulter{}
+
+// NetworktestValidator rejects Networktests and ClusterNetworktests that cannot be performed as specified
+type NetworktestValidator struct {
+	// Limits are the limits of the controller. Tests outside them are rejected when the controller rejects them,
+	// and warned about otherwise.
+	Limits testers.Limits
+}
+
+var _ admission.CustomValidator = &NetworktestValidator{}
+
+// SetupNetworktestWebhookWithManager registers the Networktest and ClusterNetworktest webhooks with the manager. The
+// conversion webhook is registered along with them.
+func SetupNetworktestWebhookWithManager(mgr ctrl.Manager, limits testers.Limits) error {
+	for _, obj := range []runtime.Object{&edgeworksnov2.Networktest{}, &edgeworksnov2.ClusterNetworktest{}} {
+		err := ctrl.NewWebhookManagedBy(mgr).
+			For(obj).
+			WithDefaulter(&NetworktestDefaulter{}).
+			WithValidator(&NetworktestValidator{Limits: limits}).
+			Complete()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Default implements admission.CustomDefaulter
+func (d *NetworktestDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	t, ok := obj.(edgeworksnov2.NetworktestObject)
+	if !ok {
+		return fmt.Errorf("expected a Networktest or ClusterNetworktest, got %T", obj)
+	}
+
+	// Missing interval and timeout are set by the defaults of the CRD. Setting them here would hide durations sent
+	// through v1 that are not valid, which are kept in annotations until the CRD rejects them.
+	spec := t.GetSpec()
+	spec.ExpectedOutcome = spec.GetExpectedOutcome()
+
+	if h := spec.HTTP; h != nil {
+		h.URL = lowerScheme(h.URL)
+		h.Method = h.GetMethod()
+	}
+	if p := spec.TCP; p != nil {
+		for i := range p.Steps {
+			p.Steps[i].Encoding = p.Steps[i].GetEncoding()
+		}
+	}
+	if p := spec.TLS; p != nil {
+		p.Port = p.GetPort()
+	}
+	if p := spec.UDP; p != nil {
+		p.Encoding = p.GetEncoding()
+	}
+	if p := spec.ICMP; p != nil {
+		p.Count = p.GetCount()
+	}
+	if p := spec.DNS; p != nil {
+		p.RecordType = p.GetRecordType()
+		if p.Nameserver != "" {
+			if _, _, err := net.SplitHostPort(p.Nameserver); err != nil {
+				p.Nameserver = net.JoinHostPort(p.Nameserver, "53")
+			}
+		}
+	}
+
+	return nil
+}
+
+// lowerScheme lower-cases the scheme of a URL, leaving the rest as given
+func lowerScheme(rawURL string) string {
+	scheme, rest, found := strings.Cut(rawURL, "://")
+	if !found {
+		return rawURL
+	}
+	return strings.ToLower(scheme) + "://" + rest
+}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *NetworktestValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return v.validate(obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *NetworktestValidator) ValidateUpdate(_ context.Context, _ runtime.Object, newObj runtime.Object) (admission.Warnings, error) {
+	return v.validate(newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator. Deletes are always allowed.
+func (v *NetworktestValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *NetworktestValidator) validate(obj runtime.Object) (admission.Warnings, error) {
+	var kind string
+	switch obj.(type) {
+	case *edgeworksnov2.Networktest:
+		kind = "Networktest"
+	case *edgeworksnov2.ClusterNetworktest:
+		kind = "ClusterNetworktest"
+	default:
+		return nil, fmt.Errorf("expected a Networktest or ClusterNetworktest, got %T", obj)
+	}
+	t := obj.(edgeworksnov2.NetworktestObject)
+
+	errs := testers.ValidateSpec(*t.GetSpec())
+	limitErrs := v.Limits.Check(*t.GetSpec())
+	if v.Limits.Reject {
+		errs = append(errs, limitErrs...)
+	}
+	if len(errs) > 0 {
+		return nil, k8errors.NewInvalid(edgeworksnov2.GroupVersion.WithKind(kind).GroupKind(), t.GetName(), errs)
+	}
+
+	w := warnings(*t.GetSpec())
+	for _, err := range limitErrs {
+		w = append(w, fmt.Sprintf("%s, the limit of the controller is used instead", err.Error()))
+	}
+	return w, nil
+}
+
+// warnings points out specs that are valid, but probably not what was intended
+func warnings(spec edgeworksnov2.NetworktestSpec) admission.Warnings {
+	var w admission.Warnings
+
+	interval := spec.GetInterval()
+	timeout := spec.GetTimeout()
+	if interval > 0 && timeout > interval {
+		w = append(w, fmt.Sprintf("spec.timeout: %s is longer than spec.interval %s, runs will be delayed", timeout, interval))
+	}
+
+	if spec.HTTP != nil && spec.HTTP.TLSSkipVerify && spec.HTTP.CABundle != nil {
+		w = append(w, "spec.http.caBundle: not used for verification when spec.http.tlsSkipVerify is true")
+	}
+
+	if spec.GRPC != nil && spec.GRPC.TLSSkipVerify && spec.GRPC.CABundle != nil {
+		w = append(w, "spec.grpc.caBundle: not used for verification when spec.grpc.tlsSkipVerify is true")
+	}
+
+	if spec.UDP != nil && spec.UDP.ExpectResponse == nil && spec.GetExpectedOutcome() == edgeworksnov2.OutcomeBlocked {
+		w = append(w, "spec.udp.expectResponse: blocked traffic can only be detected by waiting for a response")
+	}
+
+	return w
+}